@@ -0,0 +1,59 @@
+package solauth
+
+import "encoding/binary"
+
+// borshReader reads the Borsh encoded values, it sets err instead of panicking
+// when the data is too short.
+type borshReader struct {
+	data []byte
+	err  bool
+}
+
+func (r *borshReader) bytes(n int) []byte {
+	if r.err || n < 0 || n > len(r.data) {
+		r.err = true
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *borshReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *borshReader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *borshReader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *borshReader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// shortVec reads the compact-u16 length of the Solana wire format.
+func (r *borshReader) shortVec() int {
+	if r.err {
+		return 0
+	}
+	n, size, err := decodeShortVecLen(r.data)
+	if err != nil {
+		r.err = true
+		return 0
+	}
+	r.data = r.data[size:]
+	return n
+}
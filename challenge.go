@@ -0,0 +1,347 @@
+package solauth
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mr-tron/base58"
+)
+
+// DefaultChallengeTTL is the default lifetime of an issued challenge.
+const DefaultChallengeTTL = time.Minute * 5
+
+// Challenge is the message issued by the server for a wallet to sign.
+type Challenge struct {
+	// PublicKey is the wallet address the challenge was issued for.
+	PublicKey string
+	// Nonce is the unique random value of the challenge.
+	Nonce string
+	// IssuedAt is the time the challenge was issued at.
+	IssuedAt time.Time
+	// ExpiresAt is the time after which the challenge is no longer valid.
+	ExpiresAt time.Time
+	// NotBefore is the optional time the challenge becomes valid at.
+	NotBefore time.Time
+	// RequestID is the ID of the request the challenge was issued in.
+	RequestID string
+	// Message is the text the wallet must sign.
+	Message string
+}
+
+// Expired reports whether the challenge is expired at the given time.
+func (c Challenge) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+// Active reports whether the challenge can be used at the given time.
+func (c Challenge) Active(now time.Time) bool {
+	return !c.Expired(now) && !now.Before(c.NotBefore)
+}
+
+// MessageFormat builds the text of the challenge message and parses it back.
+type MessageFormat interface {
+	// Format returns the message to sign for the challenge.
+	Format(c Challenge) string
+	// Parse parses the signed message and checks that it matches
+	// the server expectations. It returns ErrInvalidChallenge
+	// if the message was not built by the same format.
+	Parse(message string) (Challenge, error)
+}
+
+// ChallengerOption is the option for the challengers.
+type ChallengerOption func(*challengerOptions)
+
+type challengerOptions struct {
+	format MessageFormat
+}
+
+func newChallengerOptions(opts []ChallengerOption) challengerOptions {
+	o := challengerOptions{format: PlainMessageFormat{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithMessageFormat sets the format of the challenge messages.
+// By default PlainMessageFormat is used.
+func WithMessageFormat(f MessageFormat) ChallengerOption {
+	return func(o *challengerOptions) {
+		o.format = f
+	}
+}
+
+// ChallengeStore keeps issued challenges until they are consumed or expired.
+type ChallengeStore interface {
+	// Put saves the challenge.
+	// The store must not return the challenge after its ExpiresAt time.
+	Put(ctx context.Context, c Challenge) error
+	// Get returns the challenge with the given nonce without removing it.
+	// It returns ErrChallengeNotFound if there is no such challenge
+	// or it has already expired.
+	Get(ctx context.Context, nonce string) (Challenge, error)
+	// Consume returns the challenge with the given nonce and removes it
+	// from the store, so every challenge can be used only once.
+	// It returns ErrChallengeNotFound if there is no such challenge
+	// or it has already expired.
+	Consume(ctx context.Context, nonce string) (Challenge, error)
+}
+
+// MemoryChallengeStore is the in-memory implementation of ChallengeStore.
+// It's suitable for a single instance deployment only.
+type MemoryChallengeStore struct {
+	mu    sync.Mutex
+	items map[string]Challenge
+}
+
+// NewMemoryChallengeStore creates a new in-memory challenge store.
+func NewMemoryChallengeStore() *MemoryChallengeStore {
+	return &MemoryChallengeStore{
+		items: make(map[string]Challenge),
+	}
+}
+
+// Put saves the challenge and drops all expired ones.
+func (s *MemoryChallengeStore) Put(_ context.Context, c Challenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for nonce, item := range s.items {
+		if item.Expired(now) {
+			delete(s.items, nonce)
+		}
+	}
+
+	s.items[c.Nonce] = c
+	return nil
+}
+
+// Get returns the challenge with the given nonce.
+func (s *MemoryChallengeStore) Get(_ context.Context, nonce string) (Challenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.items[nonce]
+	if !ok || c.Expired(time.Now()) {
+		return Challenge{}, ErrChallengeNotFound
+	}
+
+	return c, nil
+}
+
+// Consume returns the challenge with the given nonce and removes it from the store.
+func (s *MemoryChallengeStore) Consume(_ context.Context, nonce string) (Challenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.items[nonce]
+	if !ok {
+		return Challenge{}, ErrChallengeNotFound
+	}
+	delete(s.items, nonce)
+
+	if c.Expired(time.Now()) {
+		return Challenge{}, ErrChallengeNotFound
+	}
+
+	return c, nil
+}
+
+// StoredChallenger issues challenges and keeps them in a ChallengeStore
+// until they are signed by the wallet.
+type StoredChallenger struct {
+	store  ChallengeStore
+	ttl    time.Duration
+	format MessageFormat
+}
+
+// NewStoredChallenger creates a new challenger backed by the given store.
+// If ttl is not positive, DefaultChallengeTTL is used.
+func NewStoredChallenger(store ChallengeStore, ttl time.Duration, opts ...ChallengerOption) *StoredChallenger {
+	if ttl <= 0 {
+		ttl = DefaultChallengeTTL
+	}
+	o := newChallengerOptions(opts)
+	return &StoredChallenger{
+		store:  store,
+		ttl:    ttl,
+		format: o.format,
+	}
+}
+
+// IssueChallenge issues a new challenge for the given wallet address.
+func (c *StoredChallenger) IssueChallenge(ctx context.Context, publicKey string) (Challenge, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	challenge := Challenge{
+		PublicKey: publicKey,
+		Nonce:     nonce,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(c.ttl),
+		RequestID: challengeRequestID(ctx),
+	}
+	challenge.Message = c.format.Format(challenge)
+
+	if err := c.store.Put(ctx, challenge); err != nil {
+		return Challenge{}, fmt.Errorf("failed to store challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// VerifyChallenge checks that the message is the challenge issued
+// for the given wallet address, and it is not expired nor used yet.
+// The challenge is consumed only if everything matches, so the next call
+// with the same message fails, but a mismatched call doesn't burn the challenge.
+func (c *StoredChallenger) VerifyChallenge(ctx context.Context, publicKey, message string) error {
+	parsed, err := c.format.Parse(message)
+	if err != nil {
+		return err
+	}
+	if parsed.PublicKey != publicKey {
+		return ErrChallengeMismatch
+	}
+	if err := checkChallengeRequestID(ctx, parsed); err != nil {
+		return err
+	}
+
+	challenge, err := c.store.Get(ctx, parsed.Nonce)
+	if err != nil {
+		return err
+	}
+	if challenge.PublicKey != publicKey || challenge.Message != message {
+		return ErrChallengeMismatch
+	}
+	if !challenge.Active(time.Now()) {
+		return ErrChallengeNotFound
+	}
+
+	// The concurrent calls with the same message race here, only one of them consumes it
+	if _, err := c.store.Consume(ctx, parsed.Nonce); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// challengeRequestContextKey is the key for the request ID the challenges are bound to.
+var challengeRequestContextKey = &contextKey{name: "challenge_request"}
+
+// withChallengeRequestID returns the context which binds the challenges to the request ID:
+// IssueChallenge puts it into the message instead of the ID of the HTTP request,
+// and VerifyChallenge accepts only the messages with it.
+func withChallengeRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, challengeRequestContextKey, id)
+}
+
+// challengeRequestID returns the request ID of the challenge issued in the context.
+func challengeRequestID(ctx context.Context) string {
+	if id, ok := ctx.Value(challengeRequestContextKey).(string); ok {
+		return id
+	}
+	return middleware.GetReqID(ctx)
+}
+
+// checkChallengeRequestID checks the challenge has the request ID
+// the context is bound to, if any.
+func checkChallengeRequestID(ctx context.Context, c Challenge) error {
+	if id, ok := ctx.Value(challengeRequestContextKey).(string); ok && c.RequestID != id {
+		return ErrChallengeMismatch
+	}
+	return nil
+}
+
+// newNonce generates a random base58 encoded nonce.
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base58.Encode(b), nil
+}
+
+const (
+	plainMessagePrefix = "Sign this message to login as "
+	plainNonceField    = "Nonce"
+	plainIssuedAtField = "Issued At"
+	plainExpiresField  = "Expiration Time"
+	plainRequestField  = "Request ID"
+)
+
+// PlainMessageFormat is the default MessageFormat.
+// It builds a short human-readable message with the wallet address, nonce
+// and validity period of the challenge.
+type PlainMessageFormat struct{}
+
+// Format builds the text of the challenge message.
+func (PlainMessageFormat) Format(c Challenge) string {
+	var sb strings.Builder
+	sb.WriteString(plainMessagePrefix + c.PublicKey + ".\n\n")
+	sb.WriteString(plainNonceField + ": " + c.Nonce + "\n")
+	sb.WriteString(plainIssuedAtField + ": " + c.IssuedAt.UTC().Format(time.RFC3339) + "\n")
+	sb.WriteString(plainExpiresField + ": " + c.ExpiresAt.UTC().Format(time.RFC3339))
+	if c.RequestID != "" {
+		sb.WriteString("\n" + plainRequestField + ": " + c.RequestID)
+	}
+	return sb.String()
+}
+
+// Parse parses the challenge message built by Format.
+func (PlainMessageFormat) Parse(message string) (Challenge, error) {
+	c := Challenge{Message: message}
+
+	scanner := bufio.NewScanner(strings.NewReader(message))
+	if !scanner.Scan() {
+		return Challenge{}, ErrInvalidChallenge
+	}
+	first := scanner.Text()
+	if !strings.HasPrefix(first, plainMessagePrefix) || !strings.HasSuffix(first, ".") {
+		return Challenge{}, ErrInvalidChallenge
+	}
+	c.PublicKey = strings.TrimSuffix(strings.TrimPrefix(first, plainMessagePrefix), ".")
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return Challenge{}, ErrInvalidChallenge
+		}
+
+		var err error
+		switch key {
+		case plainNonceField:
+			c.Nonce = value
+		case plainIssuedAtField:
+			c.IssuedAt, err = time.Parse(time.RFC3339, value)
+		case plainExpiresField:
+			c.ExpiresAt, err = time.Parse(time.RFC3339, value)
+		case plainRequestField:
+			c.RequestID = value
+		default:
+			return Challenge{}, ErrInvalidChallenge
+		}
+		if err != nil {
+			return Challenge{}, ErrInvalidChallenge
+		}
+	}
+
+	if c.PublicKey == "" || c.Nonce == "" || c.ExpiresAt.IsZero() {
+		return Challenge{}, ErrInvalidChallenge
+	}
+
+	return c, nil
+}
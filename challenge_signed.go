@@ -0,0 +1,184 @@
+package solauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mr-tron/base58"
+)
+
+const (
+	signedNonceVersion   = 1
+	signedNonceRandSize  = 16
+	signedNonceBodySize  = 1 + 8 + 8 + signedNonceRandSize
+	signedNonceTotalSize = signedNonceBodySize + sha256.Size
+)
+
+// ReplayCache remembers used nonces of stateless challenges
+// until they expire, so every challenge can be used only once.
+type ReplayCache interface {
+	// Remember records the nonce until expiresAt.
+	// It returns false if the nonce has been already recorded.
+	Remember(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+}
+
+// MemoryReplayCache is the in-memory implementation of ReplayCache.
+type MemoryReplayCache struct {
+	mu    sync.Mutex
+	items map[string]time.Time
+}
+
+// NewMemoryReplayCache creates a new in-memory replay cache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{
+		items: make(map[string]time.Time),
+	}
+}
+
+// Remember records the nonce until expiresAt and drops all expired ones.
+func (c *MemoryReplayCache) Remember(_ context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for n, exp := range c.items {
+		if !now.Before(exp) {
+			delete(c.items, n)
+		}
+	}
+
+	if _, ok := c.items[nonce]; ok {
+		return false, nil
+	}
+	c.items[nonce] = expiresAt
+
+	return true, nil
+}
+
+// SignedChallenger issues self-verifying challenges.
+// The nonce of such challenge holds the issued-at and expiration times
+// and is authenticated with the server key together with the wallet address,
+// so the challenge can be verified without any storage lookup.
+// Use it for horizontally scaled deployments without a shared ChallengeStore.
+type SignedChallenger struct {
+	key    []byte
+	ttl    time.Duration
+	replay ReplayCache
+	format MessageFormat
+}
+
+// NewSignedChallenger creates a new stateless challenger.
+// The signingKey can be the same key as used for JWT,
+// the challenger derives its own key from it.
+// If ttl is not positive, DefaultChallengeTTL is used.
+// The replay cache is optional: without it a signed challenge can be used
+// multiple times until it expires.
+func NewSignedChallenger(signingKey []byte, ttl time.Duration, replay ReplayCache, opts ...ChallengerOption) *SignedChallenger {
+	if ttl <= 0 {
+		ttl = DefaultChallengeTTL
+	}
+
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte("solauth challenge"))
+
+	o := newChallengerOptions(opts)
+	return &SignedChallenger{
+		key:    mac.Sum(nil),
+		ttl:    ttl,
+		replay: replay,
+		format: o.format,
+	}
+}
+
+// IssueChallenge issues a new challenge for the given wallet address.
+func (c *SignedChallenger) IssueChallenge(ctx context.Context, publicKey string) (Challenge, error) {
+	now := time.Now().Truncate(time.Second)
+	challenge := Challenge{
+		PublicKey: publicKey,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(c.ttl),
+		RequestID: challengeRequestID(ctx),
+	}
+
+	body := make([]byte, signedNonceBodySize)
+	body[0] = signedNonceVersion
+	binary.BigEndian.PutUint64(body[1:9], uint64(challenge.IssuedAt.Unix()))
+	binary.BigEndian.PutUint64(body[9:17], uint64(challenge.ExpiresAt.Unix()))
+	if _, err := rand.Read(body[17:]); err != nil {
+		return Challenge{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	challenge.Nonce = base58.Encode(append(body, c.sign(body, publicKey)...))
+	challenge.Message = c.format.Format(challenge)
+
+	return challenge, nil
+}
+
+// VerifyChallenge checks that the message is the challenge issued
+// by this server for the given wallet address, and it is not expired.
+// The message must be exactly the text the configured MessageFormat issues for the nonce.
+// If the replay cache is set, the challenge can be used only once.
+func (c *SignedChallenger) VerifyChallenge(ctx context.Context, publicKey, message string) error {
+	parsed, err := c.format.Parse(message)
+	if err != nil {
+		return err
+	}
+	if parsed.PublicKey != publicKey {
+		return ErrChallengeMismatch
+	}
+	if err := checkChallengeRequestID(ctx, parsed); err != nil {
+		return err
+	}
+
+	nonce, err := base58.Decode(parsed.Nonce)
+	if err != nil || len(nonce) != signedNonceTotalSize || nonce[0] != signedNonceVersion {
+		return ErrInvalidChallenge
+	}
+
+	body, sig := nonce[:signedNonceBodySize], nonce[signedNonceBodySize:]
+	if !hmac.Equal(sig, c.sign(body, publicKey)) {
+		return ErrInvalidChallenge
+	}
+
+	// The validity period in the message must be the one signed by the server
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(body[1:9])), 0)
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(body[9:17])), 0)
+	if !parsed.IssuedAt.Equal(issuedAt) || !parsed.ExpiresAt.Equal(expiresAt) {
+		return ErrInvalidChallenge
+	}
+	if !parsed.Active(time.Now()) {
+		return ErrChallengeNotFound
+	}
+
+	// The rest of the message must be the one the server issues,
+	// so the domain, statement or resources can't be replaced in the signed text
+	if c.format.Format(parsed) != message {
+		return ErrChallengeMismatch
+	}
+
+	if c.replay != nil {
+		ok, err := c.replay.Remember(ctx, parsed.Nonce, expiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to check challenge replay: %w", err)
+		}
+		if !ok {
+			return ErrChallengeNotFound
+		}
+	}
+
+	return nil
+}
+
+// sign returns the MAC of the nonce body bound to the wallet address.
+func (c *SignedChallenger) sign(body []byte, publicKey string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(body)
+	mac.Write([]byte(publicKey))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,132 @@
+package solauth_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoredChallenger(t *testing.T) {
+	ctx := context.Background()
+	publicKey := wallet.PublicKey.ToBase58()
+
+	t.Run("single use", func(t *testing.T) {
+		c := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), time.Minute)
+
+		challenge, err := c.IssueChallenge(ctx, publicKey)
+		require.NoError(t, err)
+		require.Contains(t, challenge.Message, publicKey)
+		require.Contains(t, challenge.Message, challenge.Nonce)
+
+		require.NoError(t, c.VerifyChallenge(ctx, publicKey, challenge.Message))
+		require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, challenge.Message), solauth.ErrChallengeNotFound)
+	})
+
+	t.Run("another wallet", func(t *testing.T) {
+		c := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), time.Minute)
+
+		challenge, err := c.IssueChallenge(ctx, publicKey)
+		require.NoError(t, err)
+
+		err = c.VerifyChallenge(ctx, "9B5XszUGdMaxCZ7uSQhPzdks5ZQSmWxrmzCSvtJ6Ns6g", challenge.Message)
+		require.ErrorIs(t, err, solauth.ErrChallengeMismatch)
+
+		// the mismatched call doesn't consume the challenge
+		require.NoError(t, c.VerifyChallenge(ctx, publicKey, challenge.Message))
+	})
+
+	t.Run("tampered message", func(t *testing.T) {
+		c := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), time.Minute)
+
+		challenge, err := c.IssueChallenge(ctx, publicKey)
+		require.NoError(t, err)
+
+		tampered := strings.Replace(challenge.Message,
+			challenge.ExpiresAt.UTC().Format(time.RFC3339),
+			challenge.ExpiresAt.Add(time.Hour).UTC().Format(time.RFC3339), 1)
+		require.NotEqual(t, challenge.Message, tampered)
+		require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, tampered), solauth.ErrChallengeMismatch)
+
+		require.NoError(t, c.VerifyChallenge(ctx, publicKey, challenge.Message))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		c := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), time.Millisecond)
+
+		challenge, err := c.IssueChallenge(ctx, publicKey)
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond * 5)
+		require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, challenge.Message), solauth.ErrChallengeNotFound)
+	})
+
+	t.Run("unknown message", func(t *testing.T) {
+		c := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), time.Minute)
+		require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, "test message"), solauth.ErrInvalidChallenge)
+	})
+}
+
+func TestSignedChallenger(t *testing.T) {
+	ctx := context.Background()
+	publicKey := wallet.PublicKey.ToBase58()
+
+	t.Run("with replay cache", func(t *testing.T) {
+		c := solauth.NewSignedChallenger(authSigningKey, time.Minute, solauth.NewMemoryReplayCache())
+
+		challenge, err := c.IssueChallenge(ctx, publicKey)
+		require.NoError(t, err)
+
+		require.NoError(t, c.VerifyChallenge(ctx, publicKey, challenge.Message))
+		require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, challenge.Message), solauth.ErrChallengeNotFound)
+	})
+
+	t.Run("without replay cache", func(t *testing.T) {
+		c := solauth.NewSignedChallenger(authSigningKey, time.Minute, nil)
+
+		challenge, err := c.IssueChallenge(ctx, publicKey)
+		require.NoError(t, err)
+
+		require.NoError(t, c.VerifyChallenge(ctx, publicKey, challenge.Message))
+		require.NoError(t, c.VerifyChallenge(ctx, publicKey, challenge.Message))
+	})
+
+	t.Run("another server key", func(t *testing.T) {
+		challenge, err := solauth.NewSignedChallenger([]byte("another key"), time.Minute, nil).IssueChallenge(ctx, publicKey)
+		require.NoError(t, err)
+
+		c := solauth.NewSignedChallenger(authSigningKey, time.Minute, nil)
+		require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, challenge.Message), solauth.ErrInvalidChallenge)
+	})
+
+	t.Run("another wallet", func(t *testing.T) {
+		c := solauth.NewSignedChallenger(authSigningKey, time.Minute, nil)
+
+		challenge, err := c.IssueChallenge(ctx, publicKey)
+		require.NoError(t, err)
+
+		err = c.VerifyChallenge(ctx, "9B5XszUGdMaxCZ7uSQhPzdks5ZQSmWxrmzCSvtJ6Ns6g", challenge.Message)
+		require.ErrorIs(t, err, solauth.ErrChallengeMismatch)
+
+		// the mismatched call doesn't consume the challenge
+		require.NoError(t, c.VerifyChallenge(ctx, publicKey, challenge.Message))
+	})
+
+	t.Run("tampered message", func(t *testing.T) {
+		c := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), time.Minute)
+
+		challenge, err := c.IssueChallenge(ctx, publicKey)
+		require.NoError(t, err)
+
+		tampered := strings.Replace(challenge.Message,
+			challenge.ExpiresAt.UTC().Format(time.RFC3339),
+			challenge.ExpiresAt.Add(time.Hour).UTC().Format(time.RFC3339), 1)
+		require.NotEqual(t, challenge.Message, tampered)
+		require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, tampered), solauth.ErrChallengeMismatch)
+
+		require.NoError(t, c.VerifyChallenge(ctx, publicKey, challenge.Message))
+	})
+}
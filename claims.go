@@ -0,0 +1,122 @@
+package solauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ClaimsEnricher returns the custom claims added to the access token
+// of the wallet, e.g. tenant ID, internal user ID or feature flags.
+// It's consulted on every token issue and refresh.
+// The names of the standard and solauth claims can't be used.
+type ClaimsEnricher interface {
+	Enrich(ctx context.Context, walletAddr string) (map[string]interface{}, error)
+}
+
+// ClaimsEnricherFunc is the function adapter for ClaimsEnricher.
+type ClaimsEnricherFunc func(ctx context.Context, walletAddr string) (map[string]interface{}, error)
+
+// Enrich calls f(ctx, walletAddr).
+func (f ClaimsEnricherFunc) Enrich(ctx context.Context, walletAddr string) (map[string]interface{}, error) {
+	return f(ctx, walletAddr)
+}
+
+// claimsJSON is Claims without the custom JSON methods.
+type claimsJSON Claims
+
+// MarshalJSON encodes the claims with the custom ones at the top level.
+func (c Claims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(claimsJSON(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	for name, value := range c.Extra {
+		if _, ok := m[name]; ok || isReservedClaim(name) {
+			return nil, fmt.Errorf("custom claim %q conflicts with the reserved claim", name)
+		}
+		m[name] = value
+	}
+
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes the claims and collects the unknown ones to Extra.
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	var known claimsJSON
+	if err := json.Unmarshal(data, &known); err != nil {
+		return err
+	}
+
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	for name, raw := range m {
+		if isReservedClaim(name) {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		if known.Extra == nil {
+			known.Extra = make(map[string]interface{})
+		}
+		known.Extra[name] = value
+	}
+
+	*c = Claims(known)
+	return nil
+}
+
+// reservedClaims is the names of the standard and solauth claims.
+var reservedClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"wallet": true, "typ": true, "fid": true, "scopes": true, "roles": true, "msig": true, "signers": true, "sk": true,
+}
+
+// isReservedClaim reports whether the claim name can't be used for custom claims.
+func isReservedClaim(name string) bool {
+	return reservedClaims[name]
+}
+
+// GetCustomClaim returns the custom claim converted to T.
+// Decoded tokens have JSON values in the custom claims (e.g. numbers are float64),
+// so the value is converted through JSON if it's not T already.
+// It returns false if the claim is missing or can't be converted.
+func GetCustomClaim[T any](c *Claims, name string) (T, bool) {
+	var result T
+	if c == nil {
+		return result, false
+	}
+
+	value, ok := c.Extra[name]
+	if !ok {
+		return result, false
+	}
+	if v, ok := value.(T); ok {
+		return v, true
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return result, false
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, false
+	}
+
+	return result, true
+}
+
+// GetCustomClaimFromContext returns the custom claim of the claims
+// from the context converted to T. See GetCustomClaim.
+func GetCustomClaimFromContext[T any](ctx context.Context, name string) (T, bool) {
+	return GetCustomClaim[T](GetClaimsFromContext(ctx), name)
+}
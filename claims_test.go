@@ -0,0 +1,94 @@
+package solauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimsEnricher(t *testing.T) {
+	type flags struct {
+		Beta bool `json:"beta"`
+	}
+
+	enricher := solauth.ClaimsEnricherFunc(func(ctx context.Context, walletAddr string) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"tenant_id": "acme",
+			"user_id":   42,
+			"flags":     flags{Beta: true},
+		}, nil
+	})
+	j := solauth.NewJWT(authSigningKey, solauth.WithClaimsEnricher(enricher))
+
+	tokens, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	claims, err := j.VerifyAccessToken(tokens.Access)
+	require.NoError(t, err)
+	require.Equal(t, wallet.PublicKey.ToBase58(), claims.Wallet)
+
+	tenantID, ok := solauth.GetCustomClaim[string](claims, "tenant_id")
+	require.True(t, ok)
+	require.Equal(t, "acme", tenantID)
+
+	userID, ok := solauth.GetCustomClaim[int64](claims, "user_id")
+	require.True(t, ok)
+	require.EqualValues(t, 42, userID)
+
+	f, ok := solauth.GetCustomClaim[flags](claims, "flags")
+	require.True(t, ok)
+	require.True(t, f.Beta)
+
+	_, ok = solauth.GetCustomClaim[int](claims, "tenant_id")
+	require.False(t, ok)
+	_, ok = solauth.GetCustomClaim[string](claims, "missing")
+	require.False(t, ok)
+
+	// Refresh tokens don't carry the custom claims
+	refreshClaims, err := j.VerifyRefreshToken(tokens.Refresh)
+	require.NoError(t, err)
+	require.Empty(t, refreshClaims.Extra)
+
+	t.Run("context", func(t *testing.T) {
+		handler := solauth.Middleware(j)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenantID, ok := solauth.GetCustomClaimFromContext[string](r.Context(), "tenant_id")
+			require.True(t, ok)
+			_, _ = w.Write([]byte(tenantID))
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.Access)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, "acme", rr.Body.String())
+
+		_, ok := solauth.GetCustomClaimFromContext[string](context.Background(), "tenant_id")
+		require.False(t, ok)
+	})
+
+	t.Run("reserved claim", func(t *testing.T) {
+		j := solauth.NewJWT(authSigningKey, solauth.WithClaimsEnricher(solauth.ClaimsEnricherFunc(
+			func(ctx context.Context, walletAddr string) (map[string]interface{}, error) {
+				return map[string]interface{}{"sub": "admin"}, nil
+			},
+		)))
+		_, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+		require.Error(t, err)
+	})
+
+	t.Run("enricher error", func(t *testing.T) {
+		errTenant := errors.New("tenant not found")
+		j := solauth.NewJWT(authSigningKey, solauth.WithClaimsEnricher(solauth.ClaimsEnricherFunc(
+			func(ctx context.Context, walletAddr string) (map[string]interface{}, error) {
+				return nil, errTenant
+			},
+		)))
+		_, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+		require.ErrorIs(t, err, errTenant)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/dmitrymomot/go-env"
+	"github.com/dmitrymomot/solauth"
 	_ "github.com/joho/godotenv/autoload" // Load .env file automatically
 )
 
@@ -23,7 +24,7 @@ var (
 	// Cors
 	corsAllowedOrigins     = env.GetStrings("CORS_ALLOWED_ORIGINS", ",", []string{"*"})
 	corsAllowedMethods     = env.GetStrings("CORS_ALLOWED_METHODS", ",", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"})
-	corsAllowedHeaders     = env.GetStrings("CORS_ALLOWED_HEADERS", ",", []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Request-ID", "X-Request-Id", "Origin", "User-Agent", "Accept-Encoding", "Accept-Language", "Cache-Control", "Connection", "DNT", "Host", "Pragma", "Referer"})
+	corsAllowedHeaders     = env.GetStrings("CORS_ALLOWED_HEADERS", ",", []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Request-ID", "X-Request-Id", "Origin", "User-Agent", "Accept-Encoding", "Accept-Language", "Cache-Control", "Connection", "DNT", "Host", "Pragma", "Referer", solauth.LoginSessionSecretHeader})
 	corsAllowedCredentials = env.GetBool("CORS_ALLOWED_CREDENTIALS", true)
 	corsMaxAge             = env.GetInt("CORS_MAX_AGE", 300)
 
@@ -32,5 +33,89 @@ var (
 	buildTagRuntime = env.GetString("COMMIT_HASH", buildTag)
 
 	// Auth
+	authIssuer     = env.GetString("AUTH_ISSUER", "http://localhost:8080")
 	authSigningKey = env.GetBytes("AUTH_SIGNING_KEY", []byte("secret"))
+	// Path to PEM encoded private key (Ed25519, ECDSA P-256 or RSA) to sign tokens with.
+	// If it's set, AUTH_SIGNING_KEY is used for challenges only.
+	authSigningKeyFile = env.GetString("AUTH_SIGNING_KEY_FILE", "")
+	// Path to the keyring file or directory with PEM encoded keys to rotate them without downtime.
+	// The keyring is reloaded on SIGHUP. If it's set, AUTH_SIGNING_KEY_FILE is ignored.
+	authKeyringPath = env.GetString("AUTH_KEYRING_PATH", "")
+
+	// Tokens
+	authAccessTokenTTL  = env.GetDuration("AUTH_ACCESS_TOKEN_TTL", solauth.DefaultAccessTokenTTL)
+	authRefreshTokenTTL = env.GetDuration("AUTH_REFRESH_TOKEN_TTL", solauth.DefaultRefreshTokenTTL)
+	// Comma separated list of the audiences of issued tokens, e.g. "api.example.com,app.example.com".
+	// The "iss" claim is set to AUTH_ISSUER.
+	authAudience    = env.GetStrings("AUTH_AUDIENCE", ",", nil)
+	authClockLeeway = env.GetDuration("AUTH_CLOCK_LEEWAY", 0)
+	// Invalidate refresh tokens on use and revoke the session if a used token is presented again.
+	authRefreshTokenRotation = env.GetBool("AUTH_REFRESH_TOKEN_ROTATION", true)
+	// How long the revocation lookups are cached in process, 0 disables the cache.
+	authRevocationCacheTTL = env.GetDuration("AUTH_REVOCATION_CACHE_TTL", 0)
+	// Path to the JSON file with the static mapping of wallets to roles and scopes.
+	authRolesFile = env.GetString("AUTH_ROLES_FILE", "")
+	// Comma separated list of "client_id:client_secret" pairs allowed to call the introspection endpoint.
+	// The endpoint is disabled if the list is empty.
+	authIntrospectionClients = env.GetStrings("AUTH_INTROSPECTION_CLIENTS", ",", nil)
+	// Path to the JSON file with the allowlist and the denylist of the wallets.
+	// The file is reloaded on SIGHUP.
+	authWalletPolicyFile = env.GetString("AUTH_WALLET_POLICY_FILE", "")
+
+	// Challenges
+	authChallengeTTL = env.GetDuration("AUTH_CHALLENGE_TTL", solauth.DefaultChallengeTTL)
+
+	// Challenge mode: "stored" keeps issued challenges in memory,
+	// "signed" issues stateless challenges signed with AUTH_SIGNING_KEY.
+	authChallengeMode        = env.GetString("AUTH_CHALLENGE_MODE", "stored")
+	authChallengeReplayCache = env.GetBool("AUTH_CHALLENGE_REPLAY_CACHE", true)
+
+	// Challenge message format: "plain" or "siws" (Sign-In With Solana)
+	authMessageFormat = env.GetString("AUTH_MESSAGE_FORMAT", "plain")
+	siwsDomain        = env.GetString("SIWS_DOMAIN", "localhost:8080")
+	siwsURI           = env.GetString("SIWS_URI", "")
+	siwsStatement     = env.GetString("SIWS_STATEMENT", "Sign in to the application")
+	siwsChainID       = env.GetString("SIWS_CHAIN_ID", solauth.SIWSChainMainnet)
+	siwsResources     = env.GetStrings("SIWS_RESOURCES", ",", nil)
+
+	// Session keys: the max lifetime of the delegation signed by the main wallet.
+	// The delegation is bound to SIWS_DOMAIN.
+	sessionKeyMaxTTL = env.GetDuration("SESSION_KEY_MAX_TTL", solauth.DefaultMaxDelegationTTL)
+
+	// Cross-device QR login: the URL of the wallet page to encode in the QR code,
+	// the "session_id" query parameter is added to it.
+	qrLoginURL = env.GetString("QR_LOGIN_URL", "http://localhost:8080/login")
+	qrLoginTTL = env.GetDuration("QR_LOGIN_TTL", solauth.DefaultLoginSessionTTL)
+	// The max number of the pending login sessions, new sessions are rejected with 503 above it.
+	qrLoginMaxSessions = env.GetInt("QR_LOGIN_MAX_SESSIONS", solauth.DefaultMaxLoginSessions)
+	// How long the desktop waits for the tokens per request.
+	// The tokens endpoint is not limited by HTTP_REQUEST_TIMEOUT, so the wait may be longer.
+	qrLoginPollTimeout = env.GetDuration("QR_LOGIN_POLL_TIMEOUT", solauth.DefaultLongPollTimeout)
+	// How many requests for the tokens are allowed per IP address per minute,
+	// it's separate from the rate limit of the other endpoints.
+	qrLoginPollRateLimit = env.GetInt("QR_LOGIN_POLL_RATE_LIMIT", 120)
+
+	// Solana RPC endpoint for the access requirements
+	solanaRPCURL = env.GetString("SOLANA_RPC_URL", "https://api.mainnet-beta.solana.com")
+
+	// SPL token gate: the wallet must hold at least GATE_TOKEN_MIN_AMOUNT (in base units, at least 1) of the token
+	// to sign in, or only gets GATE_TOKEN_SCOPES and GATE_TOKEN_ROLES if GATE_TOKEN_REQUIRED is false.
+	gateTokenMint      = env.GetString("GATE_TOKEN_MINT", "")
+	gateTokenMinAmount = env.GetInt[int64]("GATE_TOKEN_MIN_AMOUNT", 1)
+	gateTokenRequired  = env.GetBool("GATE_TOKEN_REQUIRED", true)
+	gateTokenScopes    = env.GetStrings("GATE_TOKEN_SCOPES", ",", nil)
+	gateTokenRoles     = env.GetStrings("GATE_TOKEN_ROLES", ",", nil)
+	// How long the check results are cached per wallet, 0 disables the cache.
+	gateTokenCacheTTL = env.GetDuration("GATE_TOKEN_CACHE_TTL", time.Minute*5)
+
+	// NFT collection gate: the wallet must hold an NFT of the verified collection to sign in,
+	// or only gets GATE_COLLECTION_SCOPES and GATE_COLLECTION_ROLES if GATE_COLLECTION_REQUIRED is false.
+	// Compressed NFTs are checked if GATE_COLLECTION_COMPRESSED is true, SOLANA_RPC_URL must support the DAS API.
+	gateCollection           = env.GetString("GATE_COLLECTION", "")
+	gateCollectionCompressed = env.GetBool("GATE_COLLECTION_COMPRESSED", false)
+	gateCollectionRequired   = env.GetBool("GATE_COLLECTION_REQUIRED", true)
+	gateCollectionScopes     = env.GetStrings("GATE_COLLECTION_SCOPES", ",", nil)
+	gateCollectionRoles      = env.GetStrings("GATE_COLLECTION_ROLES", ",", nil)
+	// How long the check results are cached per wallet, 0 disables the cache.
+	gateCollectionCacheTTL = env.GetDuration("GATE_COLLECTION_CACHE_TTL", time.Minute*5)
 )
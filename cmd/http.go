@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
@@ -21,18 +22,25 @@ type (
 	// logger interface
 	logger interface {
 		Infof(format string, args ...interface{})
+		Warnf(format string, args ...interface{})
+		Errorf(format string, args ...interface{})
 		Fatalf(format string, args ...interface{})
 	}
 )
 
 // Init HTTP router
-func initRouter() *chi.Mux {
+// It returns the root router and the router of the API endpoints.
+// The request timeout and the rate limit are not applied globally but to the API endpoints,
+// so the long-lived and polled ones, e.g. the login session tokens, are mounted to the root router.
+func initRouter() (*chi.Mux, chi.Router) {
 	r := chi.NewRouter()
 
 	r.Use(
 		middleware.Recoverer,
-		middleware.Logger,
-		middleware.Timeout(httpRequestTimeout),
+		middleware.RequestLogger(redactingLogFormatter{
+			LogFormatter: &middleware.DefaultLogFormatter{Logger: log.New(os.Stdout, "", log.LstdFlags)},
+			params:       []string{"secret"},
+		}),
 		middleware.CleanPath,
 		middleware.StripSlashes,
 		middleware.GetHead,
@@ -46,9 +54,6 @@ func initRouter() *chi.Mux {
 			"application/x-www-form-urlencoded",
 		),
 
-		// Rate limit by IP address.
-		httprate.LimitByIP(10, 1*time.Minute),
-
 		// Basic CORS
 		// for more ideas, see: https://developer.github.com/v3/#cross-origin-resource-sharing
 		cors.Handler(cors.Options{
@@ -66,14 +71,50 @@ func initRouter() *chi.Mux {
 	r.NotFound(notFoundHandler)
 	r.MethodNotAllowed(methodNotAllowedHandler)
 
-	r.Get("/", mkRootHandler(buildTagRuntime))
-	r.Get("/health", healthCheckHandler)
+	api := r.With(
+		middleware.Timeout(httpRequestTimeout),
+
+		// Rate limit by IP address.
+		httprate.LimitByIP(10, 1*time.Minute),
+	)
+	api.Get("/", mkRootHandler(buildTagRuntime))
+	api.Get("/health", healthCheckHandler)
+
+	return r, api
+}
+
+// redactingLogFormatter hides the values of the secret query parameters in the access log,
+// e.g. the login session secret sent by EventSource.
+type redactingLogFormatter struct {
+	middleware.LogFormatter
+	params []string
+}
+
+// NewLogEntry creates the log entry of the request with the redacted URI.
+func (f redactingLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	q := r.URL.Query()
+	redacted := false
+	for _, p := range f.params {
+		if q.Has(p) {
+			q.Set(p, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return f.LogFormatter.NewLogEntry(r)
+	}
 
-	return r
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	logged := *r
+	logged.RequestURI = u.RequestURI()
+
+	return f.LogFormatter.NewLogEntry(&logged)
 }
 
 // Run HTTP server
-func runServer(httpPort int, router http.Handler, log logger) {
+// If reloadOnHUP is false, SIGHUP stops the server as well.
+func runServer(httpPort int, router http.Handler, log logger, reloadOnHUP bool) {
 	log.Infof("Starting HTTP server on port %d", httpPort)
 
 	// Server run context
@@ -82,7 +123,11 @@ func runServer(httpPort int, router http.Handler, log logger) {
 
 	// Listen for syscall signals for process to interrupt/quit
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGPIPE)
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGPIPE}
+	if !reloadOnHUP {
+		signals = append(signals, syscall.SIGHUP)
+	}
+	signal.Notify(sig, signals...)
 
 	httpServer := &http.Server{
 		Handler: router,
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/portto/solana-go-sdk/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactingLogFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	f := redactingLogFormatter{
+		LogFormatter: &middleware.DefaultLogFormatter{Logger: log.New(&buf, "", 0), NoColor: true},
+		params:       []string{"secret"},
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/auth/qr/tokens?session_id=abc&secret=t0p-s3cret", nil)
+	f.NewLogEntry(r).Write(http.StatusOK, 0, nil, 0, nil)
+
+	require.Contains(t, buf.String(), "/auth/qr/tokens?secret=REDACTED&session_id=abc")
+	require.NotContains(t, buf.String(), "t0p-s3cret")
+	// the request itself is not changed
+	require.Equal(t, "t0p-s3cret", r.URL.Query().Get("secret"))
+}
+
+func TestLoginSessionStreamOutlivesRequestTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { httpRequestTimeout = timeout }(httpRequestTimeout)
+	httpRequestTimeout = time.Millisecond * 100
+
+	wallet := types.NewAccount()
+	walletAddr := wallet.PublicKey.ToBase58()
+	j := solauth.NewJWT([]byte("f0b69cef-c945-4744-9ee2-ca5cf3376ce2"))
+
+	r, api := initRouter()
+	mountLoginSession(r, api, solauth.NewMemoryLoginSessionStore(0), solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0), j)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	post := func(path string, payload interface{}, resp interface{}) int {
+		jsonData, err := json.Marshal(payload)
+		require.NoError(t, err)
+
+		res, err := http.Post(srv.URL+path, "application/json", bytes.NewReader(jsonData))
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		if resp != nil {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(resp))
+		}
+		return res.StatusCode
+	}
+
+	var session struct {
+		SessionID string `json:"session_id"`
+		Secret    string `json:"secret"`
+	}
+	require.Equal(t, http.StatusOK, post("/auth/qr", map[string]string{}, &session))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/auth/qr/tokens?"+url.Values{
+		"session_id": {session.SessionID},
+	}.Encode(), nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(solauth.LoginSessionSecretHeader, session.Secret)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// the wallet signs in after the request timeout
+	time.Sleep(httpRequestTimeout * 3)
+
+	var c struct {
+		Message string `json:"message"`
+	}
+	require.Equal(t, http.StatusOK, post("/auth/qr/challenge", map[string]string{
+		"session_id": session.SessionID,
+		"public_key": walletAddr,
+	}, &c))
+	require.Equal(t, http.StatusNoContent, post("/auth/qr/verify", map[string]string{
+		"session_id": session.SessionID,
+		"public_key": walletAddr,
+		"message":    c.Message,
+		"signature":  base64.StdEncoding.EncodeToString(wallet.Sign([]byte(c.Message))),
+	}, nil))
+
+	scanner := bufio.NewScanner(res.Body)
+	require.True(t, scanner.Scan())
+	require.Equal(t, "event: tokens", scanner.Text())
+	require.True(t, scanner.Scan())
+	data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+	require.True(t, ok)
+
+	var tokens solauth.TokenResponse
+	require.NoError(t, json.Unmarshal([]byte(data), &tokens))
+	claims, err := j.VerifyAccessToken(tokens.Access)
+	require.NoError(t, err)
+	require.Equal(t, walletAddr, claims.Wallet)
+}
+
+func TestLoginSessionPollingRateLimit(t *testing.T) {
+	defer func(timeout time.Duration) { qrLoginPollTimeout = timeout }(qrLoginPollTimeout)
+	qrLoginPollTimeout = time.Millisecond * 10
+
+	r, api := initRouter()
+	mountLoginSession(r, api, solauth.NewMemoryLoginSessionStore(0), solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0), solauth.NewJWT([]byte("secret")))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	create := func() (int, string, string) {
+		res, err := http.Post(srv.URL+"/auth/qr", "application/json", nil)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var session struct {
+			SessionID string `json:"session_id"`
+			Secret    string `json:"secret"`
+		}
+		if res.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&session))
+		}
+		return res.StatusCode, session.SessionID, session.Secret
+	}
+
+	code, id, secret := create()
+	require.Equal(t, http.StatusOK, code)
+
+	// polling more often than the API rate limit allows
+	for i := 0; i < 15; i++ {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/auth/qr/tokens?session_id="+url.QueryEscape(id), nil)
+		require.NoError(t, err)
+		req.Header.Set(solauth.LoginSessionSecretHeader, secret)
+
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+	}
+
+	// polling doesn't use up the limit of the API endpoints
+	code, _, _ = create()
+	require.Equal(t, http.StatusOK, code)
+}
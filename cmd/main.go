@@ -2,8 +2,15 @@ package main
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/dmitrymomot/solauth"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/httprate"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,17 +24,282 @@ func main() {
 		"build_tag": buildTagRuntime,
 	})
 
+	// Solana RPC client for the access requirements and multisig vaults
+	rpcClient := solauth.NewJSONRPCClient(solanaRPCURL, nil)
+
 	// set up jwt interactor
-	jwtInteractor := solauth.NewJWT(authSigningKey)
+	jwtInteractor := initJWT(rpcClient, logger)
+
+	// Reloaders are called on SIGHUP, without them SIGHUP stops the server
+	var reloaders []func()
+	if authKeyringPath != "" {
+		reloaders = append(reloaders, reloadKeyring(jwtInteractor, authKeyringPath, logger))
+	}
+
+	// set up challenger to issue messages to sign
+	challenger := initChallenger(authChallengeMode, initMessageFormat(authMessageFormat, logger), logger)
+
+	// set up access requirements checked on sign-in
+	handlerOpts := initGates(rpcClient, logger)
+
+	// set up wallet allowlist and denylist
+	if authWalletPolicyFile != "" {
+		policy, err := solauth.NewFileWalletPolicy(authWalletPolicyFile)
+		if err != nil {
+			logger.Fatalf("Failed to load wallet policy: %s", err)
+		}
+		reloaders = append(reloaders, reloadWalletPolicy(policy, logger))
+		handlerOpts = append(handlerOpts, solauth.WithWalletPolicy(policy))
+	}
+
+	if len(reloaders) > 0 {
+		go reloadOnSignal(ctx, reloaders...)
+	}
 
 	// Init HTTP router
-	r := initRouter()
+	r, api := initRouter()
 
 	// Endpoints
-	r.Post("/auth/request", solauth.RequestAuth)
-	r.Post("/auth/verify", solauth.VerifySignedMessage(jwtInteractor))
-	r.Post("/auth/refresh", solauth.RefreshToken(jwtInteractor))
+	api.Post("/auth/request", solauth.RequestAuth(challenger, handlerOpts...))
+	api.Post("/auth/verify", solauth.VerifySignedMessage(challenger, jwtInteractor, handlerOpts...))
+	api.Post("/auth/verify/transaction", solauth.VerifySignedTransaction(challenger, jwtInteractor, handlerOpts...))
+	api.Post("/auth/verify/multisig", solauth.VerifyMultisig(challenger, jwtInteractor, rpcClient, handlerOpts...))
+	api.Post("/auth/verify/session", solauth.VerifySessionKey(challenger, jwtInteractor, siwsDomain,
+		append(handlerOpts, solauth.WithMaxDelegationTTL(sessionKeyMaxTTL))...,
+	))
+	api.Post("/auth/refresh", solauth.RefreshToken(jwtInteractor, handlerOpts...))
+	api.Post("/auth/revoke", solauth.Revoke(jwtInteractor))
+	api.With(solauth.Middleware(jwtInteractor, solauth.WithErrorHandler(solauth.JSONErrorHandler))).Post("/auth/logout", solauth.Logout(jwtInteractor))
+
+	// Cross-device QR login
+	mountLoginSession(r, api, solauth.NewMemoryLoginSessionStore(qrLoginMaxSessions), challenger, jwtInteractor, handlerOpts...)
+
+	// Discovery
+	discovery := solauth.NewDiscoveryDocument(authIssuer)
+	discovery.MessageFormat = authMessageFormat
+
+	// Token introspection for the services which don't parse tokens
+	if len(authIntrospectionClients) > 0 {
+		clients, err := solauth.ParseClientCredentials(authIntrospectionClients)
+		if err != nil {
+			logger.Fatalf("Failed to parse introspection clients: %s", err)
+		}
+		api.Post("/auth/introspect", solauth.Introspect(jwtInteractor, clients))
+		discovery.IntrospectionEndpoint = strings.TrimSuffix(authIssuer, "/") + "/auth/introspect"
+	}
+	api.Get("/.well-known/jwks.json", solauth.JWKSHandler(jwtInteractor))
+	api.Get("/.well-known/openid-configuration", solauth.DiscoveryHandler(discovery, jwtInteractor))
 
 	// Run HTTP server
-	runServer(httpPort, r, logger)
+	runServer(httpPort, r, logger, len(reloaders) > 0)
+}
+
+// Mount the cross-device QR login endpoints
+// The tokens are streamed or long-polled until the session is completed or expired,
+// so the tokens endpoint is mounted to the root router without the request timeout
+// and with its own rate limit, polling doesn't use up the limit of the API endpoints.
+func mountLoginSession(r, api chi.Router, store solauth.LoginSessionStore, c challenger, j *solauth.JWT, opts ...solauth.HandlerOption) {
+	api.Post("/auth/qr", solauth.CreateLoginSession(store, qrLoginURL, qrLoginTTL))
+	api.Post("/auth/qr/challenge", solauth.LoginSessionChallenge(store, c, opts...))
+	api.Post("/auth/qr/verify", solauth.VerifyLoginSession(store, c, j, opts...))
+	r.With(httprate.LimitByIP(qrLoginPollRateLimit, time.Minute)).
+		Get("/auth/qr/tokens", solauth.LoginSessionTokens(store, qrLoginPollTimeout))
+}
+
+// Init access requirements according to the gate settings
+func initGates(client solauth.RPCClient, log logger) []solauth.HandlerOption {
+	var gates []solauth.Gate
+
+	if gateTokenMint != "" {
+		if gateTokenMinAmount < 1 {
+			log.Fatalf("GATE_TOKEN_MIN_AMOUNT must be at least 1, got %d", gateTokenMinAmount)
+		}
+		opts := []solauth.GateOption{
+			solauth.WithGateGrant(solauth.Grant{Scopes: gateTokenScopes, Roles: gateTokenRoles}),
+		}
+		if !gateTokenRequired {
+			opts = append(opts, solauth.WithGateOptional())
+		}
+		var gate solauth.Gate = solauth.NewTokenBalanceGate(client, gateTokenMint, uint64(gateTokenMinAmount), opts...)
+		if gateTokenCacheTTL > 0 {
+			gate = solauth.NewCachedGate(gate, gateTokenCacheTTL)
+		}
+		gates = append(gates, gate)
+	}
+
+	if gateCollection != "" {
+		opts := []solauth.GateOption{
+			solauth.WithGateGrant(solauth.Grant{Scopes: gateCollectionScopes, Roles: gateCollectionRoles}),
+		}
+		if !gateCollectionRequired {
+			opts = append(opts, solauth.WithGateOptional())
+		}
+		if gateCollectionCompressed {
+			opts = append(opts, solauth.WithCompressedNFTs())
+		}
+		var gate solauth.Gate = solauth.NewCollectionGate(client, gateCollection, opts...)
+		if gateCollectionCacheTTL > 0 {
+			gate = solauth.NewCachedGate(gate, gateCollectionCacheTTL)
+		}
+		gates = append(gates, gate)
+	}
+
+	if len(gates) == 0 {
+		return nil
+	}
+	return []solauth.HandlerOption{solauth.WithGates(gates...)}
+}
+
+type challenger interface {
+	IssueChallenge(ctx context.Context, publicKey string) (solauth.Challenge, error)
+	VerifyChallenge(ctx context.Context, publicKey, message string) error
+}
+
+// Init challenger according to the challenge mode
+func initChallenger(mode string, format solauth.MessageFormat, log logger) challenger {
+	switch mode {
+	case "stored":
+		return solauth.NewStoredChallenger(
+			solauth.NewMemoryChallengeStore(),
+			authChallengeTTL,
+			solauth.WithMessageFormat(format),
+		)
+	case "signed":
+		var replay solauth.ReplayCache
+		if authChallengeReplayCache {
+			replay = solauth.NewMemoryReplayCache()
+		}
+		return solauth.NewSignedChallenger(
+			authSigningKey,
+			authChallengeTTL,
+			replay,
+			solauth.WithMessageFormat(format),
+		)
+	}
+
+	log.Fatalf("Unknown challenge mode: %s", mode)
+	return nil
+}
+
+// Init challenge message format
+func initMessageFormat(format string, log logger) solauth.MessageFormat {
+	switch format {
+	case "plain":
+		return solauth.PlainMessageFormat{}
+	case "siws":
+		return solauth.SIWSFormat{
+			Domain:    siwsDomain,
+			URI:       siwsURI,
+			Statement: siwsStatement,
+			ChainID:   siwsChainID,
+			Resources: siwsResources,
+		}
+	}
+
+	log.Fatalf("Unknown message format: %s", format)
+	return nil
+}
+
+// Init JWT interactor with the keyring, the private key from the file or the HMAC secret
+func initJWT(client solauth.RPCClient, log logger) *solauth.JWT {
+	opts := []solauth.JWTOption{
+		solauth.WithAccessTTL(authAccessTokenTTL),
+		solauth.WithRefreshTTL(authRefreshTokenTTL),
+		solauth.WithIssuer(authIssuer),
+		solauth.WithAudience(authAudience...),
+		solauth.WithLeeway(authClockLeeway),
+		solauth.WithMultisigClient(client),
+	}
+
+	var revocation solauth.RevocationStore = solauth.NewMemoryRevocationStore()
+	if authRevocationCacheTTL > 0 {
+		revocation = solauth.NewCachedRevocationStore(revocation, authRevocationCacheTTL)
+	}
+	opts = append(opts, solauth.WithRevocationStore(revocation))
+
+	if authRolesFile != "" {
+		roles, err := solauth.LoadStaticRoleResolver(authRolesFile)
+		if err != nil {
+			log.Fatalf("Failed to load roles: %s", err)
+		}
+		opts = append(opts, solauth.WithRoleResolver(roles))
+	}
+
+	if authRefreshTokenRotation {
+		opts = append(opts,
+			solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()),
+			solauth.WithSecurityEventHandler(func(_ context.Context, e solauth.SecurityEvent) {
+				log.Warnf("Security event %s: wallet=%s family=%s token_id=%s", e.Type, e.Wallet, e.Family, e.TokenID)
+			}),
+		)
+	}
+
+	if authKeyringPath != "" {
+		keyring, err := solauth.LoadKeyring(authKeyringPath)
+		if err != nil {
+			log.Fatalf("Failed to load keyring: %s", err)
+		}
+		return solauth.NewJWTWithKeyring(keyring, opts...)
+	}
+
+	if authSigningKeyFile == "" {
+		return solauth.NewJWT(authSigningKey, opts...)
+	}
+
+	data, err := os.ReadFile(authSigningKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to read signing key file: %s", err)
+	}
+
+	j, err := solauth.NewJWTFromPEM(data, opts...)
+	if err != nil {
+		log.Fatalf("Failed to parse signing key: %s", err)
+	}
+	if !j.Keyring().Keys()[0].CanSign() {
+		log.Fatalf("Signing key file must contain a private key")
+	}
+
+	return j
+}
+
+// Call the reloaders on SIGHUP
+func reloadOnSignal(ctx context.Context, reloaders ...func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			for _, reload := range reloaders {
+				reload()
+			}
+		}
+	}
+}
+
+// Reload keyring from the path
+func reloadKeyring(j *solauth.JWT, path string, log logger) func() {
+	return func() {
+		keyring, err := solauth.LoadKeyring(path)
+		if err != nil {
+			log.Errorf("Failed to reload keyring: %s", err)
+			return
+		}
+		j.SetKeyring(keyring)
+		log.Infof("Keyring reloaded: %d keys", len(keyring.Keys()))
+	}
+}
+
+// Reload wallet policy from its file
+func reloadWalletPolicy(p *solauth.FileWalletPolicy, log logger) func() {
+	return func() {
+		if err := p.Reload(); err != nil {
+			log.Errorf("Failed to reload wallet policy: %s", err)
+			return
+		}
+		log.Infof("Wallet policy reloaded")
+	}
 }
@@ -0,0 +1,228 @@
+package solauth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/portto/solana-go-sdk/common"
+)
+
+// Limits of the RPC requests of the collection gate.
+const (
+	maxMultipleAccounts = 100  // max keys of the getMultipleAccounts request
+	dasPageLimit        = 1000 // max items of the getAssetsByOwner page
+)
+
+// metadataV1Key is the Metaplex account key of the token metadata account.
+const metadataV1Key = 4
+
+// CollectionGate requires the wallet to hold an NFT of the verified Metaplex collection.
+// NFTs are checked by the collection of their token metadata,
+// compressed NFTs are checked through the Digital Asset Standard (DAS) API
+// if WithCompressedNFTs is set.
+// Frozen NFTs are counted, since staking programs freeze them in the holder's wallet.
+type CollectionGate struct {
+	client     RPCClient
+	collection string
+	opts       gateOptions
+}
+
+// WithCompressedNFTs makes the collection gate also check the compressed NFTs
+// with the getAssetsByOwner method, the RPC endpoint must support the DAS API.
+func WithCompressedNFTs() GateOption {
+	return func(o *gateOptions) {
+		o.compressed = true
+	}
+}
+
+// NewCollectionGate creates a new gate of the collection with the given address,
+// i.e. the mint of the collection NFT.
+func NewCollectionGate(client RPCClient, collection string, opts ...GateOption) *CollectionGate {
+	return &CollectionGate{
+		client:     client,
+		collection: collection,
+		opts:       newGateOptions(opts...),
+	}
+}
+
+// Check checks whether the wallet holds an NFT of the collection.
+func (g *CollectionGate) Check(ctx context.Context, walletAddr string) (Grant, error) {
+	holds, err := g.holdsNFT(ctx, walletAddr)
+	if err != nil {
+		return Grant{}, err
+	}
+	if !holds && g.opts.compressed {
+		if holds, err = g.holdsCompressedNFT(ctx, walletAddr); err != nil {
+			return Grant{}, err
+		}
+	}
+	return g.opts.result(holds, fmt.Sprintf("no NFT of collection %s", g.collection))
+}
+
+// holdsNFT checks the token metadata of the NFTs in the wallet.
+func (g *CollectionGate) holdsNFT(ctx context.Context, walletAddr string) (bool, error) {
+	mints := make(map[common.PublicKey]bool)
+	var metadata []string
+	for _, program := range []string{TokenProgramID, Token2022ProgramID} {
+		var res tokenAccounts
+		if err := g.client.Call(ctx, "getTokenAccountsByOwner", []interface{}{
+			walletAddr,
+			map[string]string{"programId": program},
+			map[string]string{"encoding": "jsonParsed", "commitment": "confirmed"},
+		}, &res); err != nil {
+			return false, err
+		}
+
+		for _, acc := range res.Value {
+			info := acc.Account.Data.Parsed.Info
+			if acc.Account.Owner != program || info.Owner != walletAddr ||
+				info.TokenAmount.Amount != "1" || info.TokenAmount.Decimals != 0 {
+				continue
+			}
+
+			mint := common.PublicKeyFromString(info.Mint)
+			if mints[mint] {
+				continue
+			}
+			pda, _, err := common.FindProgramAddress([][]byte{
+				[]byte("metadata"),
+				common.MetaplexTokenMetaProgramID.Bytes(),
+				mint.Bytes(),
+			}, common.MetaplexTokenMetaProgramID)
+			if err != nil {
+				return false, fmt.Errorf("failed to derive metadata address of mint %s: %w", info.Mint, err)
+			}
+			mints[mint] = true
+			metadata = append(metadata, pda.ToBase58())
+		}
+	}
+
+	for start := 0; start < len(metadata); start += maxMultipleAccounts {
+		end := start + maxMultipleAccounts
+		if end > len(metadata) {
+			end = len(metadata)
+		}
+
+		var res struct {
+			Value []*struct {
+				Owner string   `json:"owner"`
+				Data  []string `json:"data"`
+			} `json:"value"`
+		}
+		if err := g.client.Call(ctx, "getMultipleAccounts", []interface{}{
+			metadata[start:end],
+			map[string]string{"encoding": "base64", "commitment": "confirmed"},
+		}, &res); err != nil {
+			return false, err
+		}
+
+		for _, acc := range res.Value {
+			if acc == nil || acc.Owner != common.MetaplexTokenMetaProgramID.ToBase58() || len(acc.Data) == 0 {
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(acc.Data[0])
+			if err != nil {
+				return false, fmt.Errorf("invalid metadata account data: %w", err)
+			}
+			m, ok := parseMetadata(data)
+			if ok && mints[m.mint] && m.collectionVerified && m.collection.ToBase58() == g.collection {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// dasAssets is the result of the getAssetsByOwner method.
+type dasAssets struct {
+	Items []struct {
+		Burnt    bool `json:"burnt"`
+		Grouping []struct {
+			GroupKey   string `json:"group_key"`
+			GroupValue string `json:"group_value"`
+			// Verified is set by the newer DAS implementations only.
+			Verified *bool `json:"verified"`
+		} `json:"grouping"`
+		Compression struct {
+			Compressed bool `json:"compressed"`
+		} `json:"compression"`
+		Ownership struct {
+			Owner string `json:"owner"`
+		} `json:"ownership"`
+	} `json:"items"`
+}
+
+// holdsCompressedNFT checks the compressed NFTs of the wallet with the DAS API.
+// DAS indexers list the collection in the grouping once it's verified.
+func (g *CollectionGate) holdsCompressedNFT(ctx context.Context, walletAddr string) (bool, error) {
+	for page := 1; ; page++ {
+		var res dasAssets
+		if err := g.client.Call(ctx, "getAssetsByOwner", map[string]interface{}{
+			"ownerAddress": walletAddr,
+			"page":         page,
+			"limit":        dasPageLimit,
+		}, &res); err != nil {
+			return false, err
+		}
+
+		for _, asset := range res.Items {
+			if !asset.Compression.Compressed || asset.Burnt || asset.Ownership.Owner != walletAddr {
+				continue
+			}
+			for _, group := range asset.Grouping {
+				if group.GroupKey == "collection" && group.GroupValue == g.collection &&
+					(group.Verified == nil || *group.Verified) {
+					return true, nil
+				}
+			}
+		}
+
+		if len(res.Items) < dasPageLimit {
+			return false, nil
+		}
+	}
+}
+
+// nftMetadata is the part of the token metadata account checked by the collection gate.
+type nftMetadata struct {
+	mint               common.PublicKey
+	collection         common.PublicKey
+	collectionVerified bool
+}
+
+// parseMetadata decodes the Borsh encoded token metadata account up to the collection field.
+// The accounts are zero padded, so the metadata created before the collection field
+// was introduced is decoded with no collection.
+func parseMetadata(data []byte) (nftMetadata, bool) {
+	r := borshReader{data: data}
+	if key := r.u8(); key != metadataV1Key {
+		return nftMetadata{}, false
+	}
+	r.skip(32) // update authority
+	var m nftMetadata
+	copy(m.mint[:], r.bytes(32))
+	for i := 0; i < 3; i++ { // name, symbol, uri
+		r.skip(int(r.u32()))
+	}
+	r.skip(2) // seller fee basis points
+	if r.u8() == 1 {
+		r.skip(int(r.u32()) * 34) // creators: address, verified, share
+	}
+	r.skip(2) // primary sale happened, is mutable
+	if r.u8() == 1 {
+		r.skip(1) // edition nonce
+	}
+	if r.u8() == 1 {
+		r.skip(1) // token standard
+	}
+	if r.u8() == 1 {
+		m.collectionVerified = r.u8() == 1
+		copy(m.collection[:], r.bytes(32))
+	}
+	if r.err {
+		return nftMetadata{}, false
+	}
+	return m, true
+}
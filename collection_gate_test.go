@@ -0,0 +1,184 @@
+package solauth_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/portto/solana-go-sdk/common"
+	"github.com/portto/solana-go-sdk/types"
+	"github.com/stretchr/testify/require"
+)
+
+// metadataAccount returns the Borsh encoded token metadata account of the NFT.
+func metadataAccount(mint, collection common.PublicKey, verified bool) []byte {
+	str := func(s string) []byte {
+		b := binary.LittleEndian.AppendUint32(nil, uint32(len(s)))
+		return append(b, s...)
+	}
+
+	flag := byte(0)
+	if verified {
+		flag = 1
+	}
+
+	data := []byte{4} // MetadataV1
+	data = append(data, types.NewAccount().PublicKey.Bytes()...)
+	data = append(data, mint.Bytes()...)
+	data = append(data, str("Test NFT")...)
+	data = append(data, str("TEST")...)
+	data = append(data, str("https://example.com/nft.json")...)
+	data = binary.LittleEndian.AppendUint16(data, 500)
+	data = append(data, 1)                                       // creators
+	data = binary.LittleEndian.AppendUint32(data, 1)             // one creator
+	data = append(data, types.NewAccount().PublicKey.Bytes()...) // address
+	data = append(data, 1, 100)                                  // verified, share
+	data = append(data, 1, 1)                                    // primary sale happened, is mutable
+	data = append(data, 1, 255)                                  // edition nonce
+	data = append(data, 1, 0)                                    // token standard: non-fungible
+	data = append(data, 1, flag)                                 // collection: verified
+	data = append(data, collection.Bytes()...)
+	data = append(data, 0, 0) // uses, collection details
+
+	// metadata accounts are zero padded
+	return append(data, make([]byte, 64)...)
+}
+
+// nftAccount returns the jsonParsed token account holding the NFT.
+func nftAccount(owner string, mint common.PublicKey) map[string]interface{} {
+	acc := tokenAccount(solauth.TokenProgramID, owner, mint.ToBase58(), "1", "frozen")
+	info := acc["account"].(map[string]interface{})["data"].(map[string]interface{})["parsed"].(map[string]interface{})["info"].(map[string]interface{})
+	info["tokenAmount"] = map[string]interface{}{"amount": "1", "decimals": 0}
+	return acc
+}
+
+// handleNFTs registers the canned responses of the wallet's NFTs and their metadata.
+func handleNFTs(t *testing.T, rpc *fakeRPC, nfts map[common.PublicKey][]byte) {
+	walletAddr := wallet.PublicKey.ToBase58()
+	metadata := make(map[string][]byte)
+	var accounts []map[string]interface{}
+	for mint, data := range nfts {
+		pda, _, err := common.FindProgramAddress([][]byte{
+			[]byte("metadata"),
+			common.MetaplexTokenMetaProgramID.Bytes(),
+			mint.Bytes(),
+		}, common.MetaplexTokenMetaProgramID)
+		require.NoError(t, err)
+		metadata[pda.ToBase58()] = data
+		accounts = append(accounts, nftAccount(walletAddr, mint))
+	}
+	// fungible token, its metadata must not be requested
+	accounts = append(accounts, tokenAccount(solauth.TokenProgramID, walletAddr, testMint, "1000000", "initialized"))
+
+	rpc.handle("getTokenAccountsByOwner", func(params json.RawMessage) (interface{}, *solauth.RPCError) {
+		var p []json.RawMessage
+		require.NoError(t, json.Unmarshal(params, &p))
+		require.JSONEq(t, `"`+walletAddr+`"`, string(p[0]))
+
+		var filter struct {
+			ProgramID string `json:"programId"`
+		}
+		require.NoError(t, json.Unmarshal(p[1], &filter))
+
+		value := []map[string]interface{}{}
+		if filter.ProgramID == solauth.TokenProgramID {
+			value = accounts
+		}
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   value,
+		}, nil
+	})
+	rpc.handle("getMultipleAccounts", func(params json.RawMessage) (interface{}, *solauth.RPCError) {
+		var p []json.RawMessage
+		require.NoError(t, json.Unmarshal(params, &p))
+		var keys []string
+		require.NoError(t, json.Unmarshal(p[0], &keys))
+		require.Len(t, keys, len(nfts))
+
+		value := make([]interface{}, 0, len(keys))
+		for _, key := range keys {
+			data, ok := metadata[key]
+			require.True(t, ok, "unexpected account %s", key)
+			value = append(value, map[string]interface{}{
+				"owner": common.MetaplexTokenMetaProgramID.ToBase58(),
+				"data":  []string{base64.StdEncoding.EncodeToString(data), "base64"},
+			})
+		}
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   value,
+		}, nil
+	})
+}
+
+func TestCollectionGate(t *testing.T) {
+	ctx := context.Background()
+	walletAddr := wallet.PublicKey.ToBase58()
+
+	collection := types.NewAccount().PublicKey
+	unverified := types.NewAccount().PublicKey
+	compressed := types.NewAccount().PublicKey
+
+	rpc := newFakeRPC(t)
+	client := solauth.NewJSONRPCClient(rpc.URL, nil)
+
+	nft1, nft2 := types.NewAccount().PublicKey, types.NewAccount().PublicKey
+	handleNFTs(t, rpc, map[common.PublicKey][]byte{
+		nft1: metadataAccount(nft1, collection, true),
+		nft2: metadataAccount(nft2, unverified, false),
+	})
+	rpc.handle("getAssetsByOwner", func(params json.RawMessage) (interface{}, *solauth.RPCError) {
+		var p struct {
+			OwnerAddress string `json:"ownerAddress"`
+			Page         int    `json:"page"`
+		}
+		require.NoError(t, json.Unmarshal(params, &p))
+		require.Equal(t, walletAddr, p.OwnerAddress)
+		require.Equal(t, 1, p.Page)
+
+		asset := func(collection string, burnt bool) map[string]interface{} {
+			return map[string]interface{}{
+				"id":          types.NewAccount().PublicKey.ToBase58(),
+				"burnt":       burnt,
+				"grouping":    []map[string]interface{}{{"group_key": "collection", "group_value": collection}},
+				"compression": map[string]interface{}{"compressed": true},
+				"ownership":   map[string]interface{}{"owner": walletAddr},
+			}
+		}
+		return map[string]interface{}{
+			"total": 2,
+			"limit": 1000,
+			"page":  1,
+			"items": []interface{}{asset(compressed.ToBase58(), false), asset(unverified.ToBase58(), true)},
+		}, nil
+	})
+
+	grant := solauth.Grant{Roles: []string{"holder"}}
+
+	res, err := solauth.NewCollectionGate(client, collection.ToBase58(), solauth.WithGateGrant(grant)).Check(ctx, walletAddr)
+	require.NoError(t, err)
+	require.Equal(t, grant, res)
+
+	_, err = solauth.NewCollectionGate(client, unverified.ToBase58(), solauth.WithGateGrant(grant)).Check(ctx, walletAddr)
+	require.ErrorIs(t, err, solauth.ErrGateDenied)
+
+	_, err = solauth.NewCollectionGate(client, compressed.ToBase58(), solauth.WithGateGrant(grant)).Check(ctx, walletAddr)
+	require.ErrorIs(t, err, solauth.ErrGateDenied)
+	require.Zero(t, rpc.callsOf("getAssetsByOwner"))
+
+	res, err = solauth.NewCollectionGate(client, compressed.ToBase58(), solauth.WithGateGrant(grant), solauth.WithCompressedNFTs()).Check(ctx, walletAddr)
+	require.NoError(t, err)
+	require.Equal(t, grant, res)
+
+	// burnt compressed NFTs are not counted
+	_, err = solauth.NewCollectionGate(client, unverified.ToBase58(), solauth.WithGateGrant(grant), solauth.WithCompressedNFTs()).Check(ctx, walletAddr)
+	require.ErrorIs(t, err, solauth.ErrGateDenied)
+
+	res, err = solauth.NewCollectionGate(client, unverified.ToBase58(), solauth.WithGateGrant(grant), solauth.WithGateOptional()).Check(ctx, walletAddr)
+	require.NoError(t, err)
+	require.Empty(t, res)
+}
@@ -0,0 +1,169 @@
+package solauth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mr-tron/base58"
+)
+
+// Encoding is the text encoding of the binary values in the payloads.
+type Encoding string
+
+// Supported encodings.
+const (
+	// EncodingAuto detects the encoding by the value itself.
+	// The encodings are tried in the order: bytes array, hex, base58, base64, base64url,
+	// and the first one which gives the expected size wins. An alphanumeric unpadded
+	// base64 value can be valid base58 of the same size as well, e.g. a base64 public key,
+	// and it's decoded as base58 to the wrong bytes, so non-base58 clients
+	// should set the encoding explicitly.
+	EncodingAuto Encoding = ""
+	// EncodingBase58 is the bitcoin alphabet base58, the default for Solana addresses.
+	EncodingBase58 Encoding = "base58"
+	// EncodingBase64 is the standard base64, with or without padding.
+	EncodingBase64 Encoding = "base64"
+	// EncodingBase64URL is the URL-safe base64, with or without padding.
+	EncodingBase64URL Encoding = "base64url"
+	// EncodingHex is the hexadecimal encoding.
+	EncodingHex Encoding = "hex"
+	// EncodingBytes is the JSON array of byte values, e.g. serialized Uint8Array.
+	EncodingBytes Encoding = "bytes"
+)
+
+// Validate checks that the encoding is supported.
+func (e Encoding) Validate() error {
+	switch e {
+	case EncodingAuto, EncodingBase58, EncodingBase64, EncodingBase64URL, EncodingHex, EncodingBytes:
+		return nil
+	}
+	return fmt.Errorf("unsupported encoding: %q", string(e))
+}
+
+// DecodeError is the error of decoding a payload field.
+type DecodeError struct {
+	// Field is the name of the payload field.
+	Field string
+	// Encoding is the encoding the field was decoded with,
+	// empty if the encoding could not be detected.
+	Encoding Encoding
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	if e.Encoding == EncodingAuto {
+		return fmt.Sprintf("failed to decode %s: %v", e.Field, e.Err)
+	}
+	return fmt.Sprintf("failed to decode %s as %s: %v", e.Field, e.Encoding, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodePublicKey decodes the ed25519 public key with the given encoding.
+// With EncodingAuto the encoding is detected by the value.
+func DecodePublicKey(s string, enc Encoding) ([]byte, error) {
+	return decodeField("public_key", s, enc, ed25519.PublicKeySize)
+}
+
+// DecodeSignature decodes the ed25519 signature with the given encoding.
+// With EncodingAuto the encoding is detected by the value.
+func DecodeSignature(s string, enc Encoding) ([]byte, error) {
+	return decodeField("signature", s, enc, ed25519.SignatureSize)
+}
+
+// decodeField decodes the value of the field and checks its size.
+// With EncodingAuto the value is decoded with the first encoding of the expected size,
+// base58 takes precedence over base64, since it's the native encoding of Solana.
+func decodeField(field, s string, enc Encoding, size int) ([]byte, error) {
+	if s == "" {
+		return nil, &DecodeError{Field: field, Encoding: enc, Err: errors.New("empty value")}
+	}
+
+	if enc == EncodingAuto {
+		for _, e := range []Encoding{EncodingBytes, EncodingHex, EncodingBase58, EncodingBase64, EncodingBase64URL} {
+			if b, err := decodeWith(s, e); err == nil && len(b) == size {
+				return b, nil
+			}
+		}
+		return nil, &DecodeError{
+			Field: field,
+			Err:   fmt.Errorf("value is not %d bytes encoded as base58, base64, base64url, hex or bytes array", size),
+		}
+	}
+
+	b, err := decodeWith(s, enc)
+	if err != nil {
+		return nil, &DecodeError{Field: field, Encoding: enc, Err: err}
+	}
+	if len(b) != size {
+		return nil, &DecodeError{Field: field, Encoding: enc, Err: fmt.Errorf("expected %d bytes, got %d", size, len(b))}
+	}
+
+	return b, nil
+}
+
+// decodeWith decodes the string with the given encoding.
+func decodeWith(s string, enc Encoding) ([]byte, error) {
+	switch enc {
+	case EncodingBase58:
+		return base58.Decode(s)
+	case EncodingBase64:
+		if strings.HasSuffix(s, "=") {
+			return base64.StdEncoding.DecodeString(s)
+		}
+		return base64.RawStdEncoding.DecodeString(s)
+	case EncodingBase64URL:
+		if strings.HasSuffix(s, "=") {
+			return base64.URLEncoding.DecodeString(s)
+		}
+		return base64.RawURLEncoding.DecodeString(s)
+	case EncodingHex:
+		return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	case EncodingBytes:
+		var values []int
+		if err := json.Unmarshal([]byte(s), &values); err != nil {
+			return nil, fmt.Errorf("invalid bytes array: %w", err)
+		}
+		b := make([]byte, len(values))
+		for i, v := range values {
+			if v < 0 || v > 255 {
+				return nil, fmt.Errorf("invalid byte value at index %d: %d", i, v)
+			}
+			b[i] = byte(v)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding: %q", string(enc))
+}
+
+// stringOrBytes unmarshals the JSON value which can be either a string
+// or an array of byte values. The array is kept as its compact JSON text,
+// so it can be decoded later with EncodingBytes.
+func stringOrBytes(raw json.RawMessage) (string, error) {
+	raw = json.RawMessage(strings.TrimSpace(string(raw)))
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	if raw[0] == '[' {
+		var values []int
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(values)
+		return string(b), err
+	}
+
+	var s string
+	err := json.Unmarshal(raw, &s)
+	return s, err
+}
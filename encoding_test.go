@@ -0,0 +1,103 @@
+package solauth_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/mr-tron/base58"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeSignature(t *testing.T) {
+	signature := wallet.Sign([]byte("test message"))
+	bytesArray, err := json.Marshal(toInts(signature))
+	require.NoError(t, err)
+
+	for enc, value := range map[solauth.Encoding]string{
+		solauth.EncodingBase58:    base58.Encode(signature),
+		solauth.EncodingBase64:    base64.StdEncoding.EncodeToString(signature),
+		solauth.EncodingBase64URL: base64.RawURLEncoding.EncodeToString(signature),
+		solauth.EncodingHex:       hex.EncodeToString(signature),
+		solauth.EncodingBytes:     string(bytesArray),
+	} {
+		decoded, err := solauth.DecodeSignature(value, enc)
+		require.NoError(t, err, enc)
+		require.Equal(t, signature, decoded, enc)
+
+		decoded, err = solauth.DecodeSignature(value, solauth.EncodingAuto)
+		require.NoError(t, err, enc)
+		require.Equal(t, signature, decoded, enc)
+	}
+
+	t.Run("base64 valid as base58", func(t *testing.T) {
+		// the unpadded base64 of 32 bytes made of alphanumerics only
+		value := "n6ixusPM1d7n8PkCCxQdJi84QUpTXGVud4CJkpukrbY"
+		publicKey, err := base64.RawStdEncoding.DecodeString(value)
+		require.NoError(t, err)
+
+		// base58 takes precedence
+		decoded, err := solauth.DecodePublicKey(value, solauth.EncodingAuto)
+		require.NoError(t, err)
+		asBase58, err := base58.Decode(value)
+		require.NoError(t, err)
+		require.Equal(t, asBase58, decoded)
+		require.NotEqual(t, publicKey, decoded)
+
+		decoded, err = solauth.DecodePublicKey(value, solauth.EncodingBase64)
+		require.NoError(t, err)
+		require.Equal(t, publicKey, decoded)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := solauth.DecodeSignature("not hex", solauth.EncodingHex)
+		var decodeErr *solauth.DecodeError
+		require.True(t, errors.As(err, &decodeErr))
+		require.Equal(t, "signature", decodeErr.Field)
+		require.Equal(t, solauth.EncodingHex, decodeErr.Encoding)
+
+		_, err = solauth.DecodeSignature(hex.EncodeToString(signature[:32]), solauth.EncodingHex)
+		require.EqualError(t, err, "failed to decode signature as hex: expected 64 bytes, got 32")
+
+		_, err = solauth.DecodePublicKey("???", solauth.EncodingAuto)
+		require.ErrorContains(t, err, "failed to decode public_key")
+	})
+}
+
+func TestVerifySignedMessagePayload(t *testing.T) {
+	publicKey := wallet.PublicKey.Bytes()
+	signature := wallet.Sign([]byte("test message"))
+
+	data, err := json.Marshal(map[string]interface{}{
+		"message":    "test message",
+		"signature":  toInts(signature),
+		"public_key": toInts(publicKey),
+		"encoding":   "bytes",
+	})
+	require.NoError(t, err)
+
+	var payload solauth.VerifySignedMessagePayload
+	require.NoError(t, json.Unmarshal(data, &payload))
+	require.NoError(t, payload.Validate())
+	require.Equal(t, "test message", payload.Message)
+	require.Equal(t, solauth.EncodingBytes, payload.Encoding)
+
+	decoded, err := solauth.DecodeSignature(payload.Signature, payload.Encoding)
+	require.NoError(t, err)
+	require.Equal(t, signature, decoded)
+
+	decoded, err = solauth.DecodePublicKey(payload.PublicKey, payload.PublicKeyEncoding)
+	require.NoError(t, err)
+	require.Equal(t, publicKey, decoded)
+}
+
+func toInts(b []byte) []int {
+	ints := make([]int, len(b))
+	for i, v := range b {
+		ints[i] = int(v)
+	}
+	return ints
+}
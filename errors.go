@@ -4,5 +4,29 @@ import "errors"
 
 // Predefined errors
 var (
-	ErrUnauthorized = errors.New("Missing or invalid access token")
+	ErrUnauthorized             = errors.New("Missing or invalid access token")
+	ErrInvalidChallenge         = errors.New("Invalid challenge message")
+	ErrChallengeNotFound        = errors.New("Challenge not found, expired or already used")
+	ErrChallengeMismatch        = errors.New("Challenge was issued for another wallet")
+	ErrVerifyOnly               = errors.New("JWT interactor has no private key and can verify tokens only")
+	ErrRefreshTokenReused       = errors.New("Refresh token was already used, the session is revoked")
+	ErrRefreshTokenRevoked      = errors.New("Refresh token is revoked or expired")
+	ErrInvalidToken             = errors.New("Invalid or expired token")
+	ErrTokenRevoked             = errors.New("Token is revoked")
+	ErrUnknownKey               = errors.New("Unknown or retired signing key")
+	ErrUnexpectedTokenType      = errors.New("Unexpected token type")
+	ErrInsufficientScope        = errors.New("Insufficient scope")
+	ErrInsufficientRole         = errors.New("Insufficient role")
+	ErrGateDenied               = errors.New("Wallet doesn't meet the access requirements")
+	ErrInvalidClientCredentials = errors.New("Invalid client credentials")
+	ErrWalletNotAllowed         = errors.New("Wallet is not allowed")
+	ErrWalletBanned             = errors.New("Wallet is banned")
+	ErrInvalidMultisig          = errors.New("Invalid multisig account")
+	ErrNotMultisigMember        = errors.New("Signer is not a voting member of the multisig")
+	ErrMultisigThreshold        = errors.New("Not enough signatures of the multisig members")
+	ErrInvalidDelegation        = errors.New("Invalid session key delegation")
+	ErrDelegationExpired        = errors.New("Session key delegation is expired or not yet valid")
+	ErrLoginSessionNotFound     = errors.New("Login session not found or expired")
+	ErrLoginSessionCompleted    = errors.New("Login session is already completed")
+	ErrTooManyLoginSessions     = errors.New("Too many pending login sessions")
 )
@@ -0,0 +1,254 @@
+package solauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SPL token program IDs.
+const (
+	TokenProgramID     = "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA"
+	Token2022ProgramID = "TokenzQdBNbLqP5VEhdkAS6EPFLC1PHnBqCXEpPxuEb"
+)
+
+// Gate is the access requirement checked on sign-in, e.g. holding a token.
+// Check returns the grant of the wallet which passes the gate.
+// If the wallet doesn't pass, the required gate returns error wrapping ErrGateDenied,
+// and the optional one returns the empty grant.
+type Gate interface {
+	Check(ctx context.Context, walletAddr string) (Grant, error)
+}
+
+// GateOption is the option for the built-in gates.
+type GateOption func(*gateOptions)
+
+// gateOptions is the set of the gate options.
+type gateOptions struct {
+	grant      Grant
+	optional   bool
+	compressed bool
+}
+
+// WithGateGrant sets the scopes and roles granted to the wallet which passes the gate.
+func WithGateGrant(g Grant) GateOption {
+	return func(o *gateOptions) {
+		o.grant = g
+	}
+}
+
+// WithGateOptional makes the gate a source of scopes and roles only:
+// the wallet which doesn't pass the gate can still sign in without the grant.
+func WithGateOptional() GateOption {
+	return func(o *gateOptions) {
+		o.optional = true
+	}
+}
+
+// newGateOptions returns the options with the defaults applied.
+func newGateOptions(opts ...GateOption) gateOptions {
+	o := gateOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// result returns the result of the gate check.
+func (o gateOptions) result(passed bool, reason string) (Grant, error) {
+	if passed {
+		return o.grant, nil
+	}
+	if o.optional {
+		return Grant{}, nil
+	}
+	return Grant{}, fmt.Errorf("%w: %s", ErrGateDenied, reason)
+}
+
+// CheckGates checks all the gates and returns the merged grant.
+func CheckGates(ctx context.Context, walletAddr string, gates ...Gate) (Grant, error) {
+	var grant Grant
+	for _, g := range gates {
+		res, err := g.Check(ctx, walletAddr)
+		if err != nil {
+			return Grant{}, err
+		}
+		grant = grant.merge(res)
+	}
+	return grant, nil
+}
+
+// CachedGate caches the results of the underlying gate per wallet,
+// so signing in and refreshing tokens doesn't hit the RPC endpoint on every request.
+// Both passed and denied checks are cached for ttl, the RPC errors are not.
+type CachedGate struct {
+	gate Gate
+	ttl  time.Duration
+
+	mu      sync.RWMutex
+	items   map[string]cachedGateResult
+	sweptAt time.Time
+}
+
+// cachedGateResult is the cached check result.
+type cachedGateResult struct {
+	grant Grant
+	err   error
+	until time.Time
+}
+
+// NewCachedGate creates a new cache in front of the given gate.
+// Check results are cached for ttl.
+func NewCachedGate(gate Gate, ttl time.Duration) *CachedGate {
+	return &CachedGate{
+		gate:    gate,
+		ttl:     ttl,
+		items:   make(map[string]cachedGateResult),
+		sweptAt: time.Now(),
+	}
+}
+
+// Check returns the cached check result or checks the underlying gate.
+func (g *CachedGate) Check(ctx context.Context, walletAddr string) (Grant, error) {
+	now := time.Now()
+
+	g.mu.RLock()
+	item, ok := g.items[walletAddr]
+	g.mu.RUnlock()
+	if ok && now.Before(item.until) {
+		return item.grant, item.err
+	}
+
+	grant, err := g.gate.Check(ctx, walletAddr)
+	if err != nil && !errors.Is(err, ErrGateDenied) {
+		return Grant{}, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.sweptAt) >= g.ttl {
+		for addr, it := range g.items {
+			if !now.Before(it.until) {
+				delete(g.items, addr)
+			}
+		}
+		g.sweptAt = now
+	}
+	g.items[walletAddr] = cachedGateResult{grant: grant, err: err, until: now.Add(g.ttl)}
+
+	return grant, err
+}
+
+// Forget drops the cached result of the wallet, e.g. when it's known to have changed.
+func (g *CachedGate) Forget(walletAddr string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.items, walletAddr)
+}
+
+// grantContextKey is the key for the grant in the context.
+var grantContextKey = &contextKey{name: "grant"}
+
+// WithGrant returns the context with the grant,
+// IssueTokens adds it to the access token claims.
+func WithGrant(ctx context.Context, g Grant) context.Context {
+	return context.WithValue(ctx, grantContextKey, GrantFromContext(ctx).merge(g))
+}
+
+// GrantFromContext returns the grant from the context.
+func GrantFromContext(ctx context.Context) Grant {
+	g, _ := ctx.Value(grantContextKey).(Grant)
+	return g
+}
+
+// TokenBalanceGate requires the wallet to hold at least the minimum amount
+// of the SPL token, Token and Token-2022 accounts are counted.
+type TokenBalanceGate struct {
+	client    RPCClient
+	mint      string
+	minAmount uint64
+	opts      gateOptions
+}
+
+// NewTokenBalanceGate creates a new gate of the token with the given mint address.
+// The minimum amount is in the base units of the token, e.g. 1_000_000 is 1 token with 6 decimals.
+func NewTokenBalanceGate(client RPCClient, mint string, minAmount uint64, opts ...GateOption) *TokenBalanceGate {
+	return &TokenBalanceGate{
+		client:    client,
+		mint:      mint,
+		minAmount: minAmount,
+		opts:      newGateOptions(opts...),
+	}
+}
+
+// Check checks the token balance of the wallet.
+func (g *TokenBalanceGate) Check(ctx context.Context, walletAddr string) (Grant, error) {
+	balance, err := TokenBalance(ctx, g.client, walletAddr, g.mint)
+	if err != nil {
+		return Grant{}, err
+	}
+	return g.opts.result(balance >= g.minAmount, fmt.Sprintf("insufficient balance of token %s", g.mint))
+}
+
+// tokenAccounts is the result of the getTokenAccountsByOwner method with jsonParsed encoding.
+type tokenAccounts struct {
+	Value []struct {
+		Pubkey  string `json:"pubkey"`
+		Account struct {
+			Owner string `json:"owner"`
+			Data  struct {
+				Parsed struct {
+					Info struct {
+						Mint        string `json:"mint"`
+						Owner       string `json:"owner"`
+						State       string `json:"state"`
+						TokenAmount struct {
+							Amount   string `json:"amount"`
+							Decimals int    `json:"decimals"`
+						} `json:"tokenAmount"`
+					} `json:"info"`
+				} `json:"parsed"`
+			} `json:"data"`
+		} `json:"account"`
+	} `json:"value"`
+}
+
+// TokenBalance returns the total balance of the token in the base units
+// in all Token and Token-2022 accounts of the wallet.
+// Frozen accounts are not counted.
+func TokenBalance(ctx context.Context, client RPCClient, walletAddr, mint string) (uint64, error) {
+	var res tokenAccounts
+	if err := client.Call(ctx, "getTokenAccountsByOwner", []interface{}{
+		walletAddr,
+		map[string]string{"mint": mint},
+		map[string]string{"encoding": "jsonParsed", "commitment": "confirmed"},
+	}, &res); err != nil {
+		return 0, err
+	}
+
+	var total uint64
+	for _, acc := range res.Value {
+		if acc.Account.Owner != TokenProgramID && acc.Account.Owner != Token2022ProgramID {
+			continue
+		}
+		info := acc.Account.Data.Parsed.Info
+		if info.Mint != mint || info.Owner != walletAddr || info.State == "frozen" {
+			continue
+		}
+
+		amount, err := strconv.ParseUint(info.TokenAmount.Amount, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount of token account %s: %w", acc.Pubkey, err)
+		}
+		if total > math.MaxUint64-amount {
+			return math.MaxUint64, nil
+		}
+		total += amount
+	}
+
+	return total, nil
+}
@@ -0,0 +1,190 @@
+package solauth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+const testMint = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v"
+
+// tokenAccount returns the jsonParsed token account of the fake RPC response.
+func tokenAccount(program, owner, mint, amount, state string) map[string]interface{} {
+	return map[string]interface{}{
+		"pubkey": "account-" + amount,
+		"account": map[string]interface{}{
+			"owner": program,
+			"data": map[string]interface{}{
+				"program": "spl-token",
+				"parsed": map[string]interface{}{
+					"type": "account",
+					"info": map[string]interface{}{
+						"mint":        mint,
+						"owner":       owner,
+						"state":       state,
+						"tokenAmount": map[string]interface{}{"amount": amount, "decimals": 6},
+					},
+				},
+			},
+		},
+	}
+}
+
+// handleTokenAccounts registers the canned getTokenAccountsByOwner response.
+func handleTokenAccounts(t *testing.T, rpc *fakeRPC, accounts ...map[string]interface{}) {
+	rpc.handle("getTokenAccountsByOwner", func(params json.RawMessage) (interface{}, *solauth.RPCError) {
+		var p []json.RawMessage
+		require.NoError(t, json.Unmarshal(params, &p))
+		require.JSONEq(t, `"`+wallet.PublicKey.ToBase58()+`"`, string(p[0]))
+		require.JSONEq(t, `{"mint":"`+testMint+`"}`, string(p[1]))
+
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value":   accounts,
+		}, nil
+	})
+}
+
+func TestTokenBalanceGate(t *testing.T) {
+	ctx := context.Background()
+	walletAddr := wallet.PublicKey.ToBase58()
+
+	rpc := newFakeRPC(t)
+	handleTokenAccounts(t, rpc,
+		tokenAccount(solauth.TokenProgramID, walletAddr, testMint, "600000", "initialized"),
+		tokenAccount(solauth.Token2022ProgramID, walletAddr, testMint, "400000", "initialized"),
+		tokenAccount(solauth.TokenProgramID, walletAddr, testMint, "5000000", "frozen"),
+	)
+	client := solauth.NewJSONRPCClient(rpc.URL, nil)
+
+	balance, err := solauth.TokenBalance(ctx, client, walletAddr, testMint)
+	require.NoError(t, err)
+	require.EqualValues(t, 1000000, balance)
+
+	grant := solauth.Grant{Scopes: []string{"holder"}}
+
+	gate := solauth.NewTokenBalanceGate(client, testMint, 1000000, solauth.WithGateGrant(grant))
+	res, err := gate.Check(ctx, walletAddr)
+	require.NoError(t, err)
+	require.Equal(t, grant, res)
+
+	gate = solauth.NewTokenBalanceGate(client, testMint, 1000001, solauth.WithGateGrant(grant))
+	_, err = gate.Check(ctx, walletAddr)
+	require.ErrorIs(t, err, solauth.ErrGateDenied)
+
+	gate = solauth.NewTokenBalanceGate(client, testMint, 1000001, solauth.WithGateGrant(grant), solauth.WithGateOptional())
+	res, err = gate.Check(ctx, walletAddr)
+	require.NoError(t, err)
+	require.Empty(t, res)
+}
+
+func TestVerifySignedMessageWithGates(t *testing.T) {
+	walletAddr := wallet.PublicKey.ToBase58()
+
+	rpc := newFakeRPC(t)
+	client := solauth.NewJSONRPCClient(rpc.URL, nil)
+	gate := solauth.NewTokenBalanceGate(client, testMint, 100, solauth.WithGateGrant(solauth.Grant{
+		Scopes: []string{"holder"},
+		Roles:  []string{"member"},
+	}))
+
+	j := solauth.NewJWT(authSigningKey)
+	challenger := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0)
+	handler := solauth.VerifySignedMessage(challenger, j, solauth.WithGates(gate))
+
+	signIn := func() *httptest.ResponseRecorder {
+		challenge, err := challenger.IssueChallenge(context.Background(), walletAddr)
+		require.NoError(t, err)
+
+		jsonData, err := json.Marshal(solauth.VerifySignedMessagePayload{
+			Message:   challenge.Message,
+			Signature: base64.StdEncoding.EncodeToString(wallet.Sign([]byte(challenge.Message))),
+			PublicKey: walletAddr,
+		})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/auth/verify", bytes.NewReader(jsonData)))
+		return rr
+	}
+
+	handleTokenAccounts(t, rpc, tokenAccount(solauth.TokenProgramID, walletAddr, testMint, "50", "initialized"))
+	rr := signIn()
+	require.Equal(t, http.StatusForbidden, rr.Code)
+
+	handleTokenAccounts(t, rpc, tokenAccount(solauth.Token2022ProgramID, walletAddr, testMint, "150", "initialized"))
+	rr = signIn()
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var tokens solauth.TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&tokens))
+	claims, err := j.VerifyAccessToken(tokens.Access)
+	require.NoError(t, err)
+	require.Equal(t, []string{"holder"}, claims.Scopes)
+	require.Equal(t, []string{"member"}, claims.Roles)
+
+	// The gates are checked again on refresh
+	refresh := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		body := `{"refresh_token":"` + tokens.Refresh + `"}`
+		solauth.RefreshToken(j, solauth.WithGates(gate))(rr, httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewReader([]byte(body))))
+		return rr
+	}
+
+	rr = refresh()
+	require.Equal(t, http.StatusOK, rr.Code)
+	var refreshed solauth.TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&refreshed))
+	claims, err = j.VerifyAccessToken(refreshed.Access)
+	require.NoError(t, err)
+	require.Equal(t, []string{"holder"}, claims.Scopes)
+
+	handleTokenAccounts(t, rpc)
+	rr = refresh()
+	require.Equal(t, http.StatusForbidden, rr.Code)
+
+	t.Run("rpc failure", func(t *testing.T) {
+		rpc.handle("getTokenAccountsByOwner", func(params json.RawMessage) (interface{}, *solauth.RPCError) {
+			return nil, &solauth.RPCError{Code: -32005, Message: "Node is behind"}
+		})
+		rr := signIn()
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestCachedGate(t *testing.T) {
+	ctx := context.Background()
+	walletAddr := wallet.PublicKey.ToBase58()
+
+	rpc := newFakeRPC(t)
+	client := solauth.NewJSONRPCClient(rpc.URL, nil)
+	gate := solauth.NewCachedGate(solauth.NewTokenBalanceGate(client, testMint, 100), time.Minute)
+
+	// RPC errors are not cached
+	_, err := gate.Check(ctx, walletAddr)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, solauth.ErrGateDenied)
+
+	handleTokenAccounts(t, rpc, tokenAccount(solauth.TokenProgramID, walletAddr, testMint, "50", "initialized"))
+	for i := 0; i < 3; i++ {
+		_, err = gate.Check(ctx, walletAddr)
+		require.ErrorIs(t, err, solauth.ErrGateDenied)
+	}
+	require.Equal(t, 2, rpc.callsOf("getTokenAccountsByOwner"))
+
+	handleTokenAccounts(t, rpc, tokenAccount(solauth.TokenProgramID, walletAddr, testMint, "150", "initialized"))
+	gate.Forget(walletAddr)
+	for i := 0; i < 3; i++ {
+		_, err = gate.Check(ctx, walletAddr)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, rpc.callsOf("getTokenAccountsByOwner"))
+}
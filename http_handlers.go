@@ -1,11 +1,15 @@
 package solauth
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
-	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mr-tron/base58"
 )
 
 // helper to send response as a json data
@@ -25,33 +29,68 @@ type RequestAuthHandlePayload struct {
 // It gets the wallet address and returns message to sign.
 // The message must be signed by the wallet and sent back to the server.
 // The server will verify the signature and return the result.
-func RequestAuth(w http.ResponseWriter, r *http.Request) {
-	// Parse JSON request
-	var payload RequestAuthHandlePayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+func RequestAuth(challenger interface {
+	IssueChallenge(ctx context.Context, publicKey string) (Challenge, error)
+}, opts ...HandlerOption,
+) http.HandlerFunc {
+	o := newHandlerOptions(opts...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse JSON request
+		var payload RequestAuthHandlePayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		o.issueChallenge(w, r, challenger, payload.PublicKey)
+	}
+}
+
+// issueChallenge issues the challenge for the wallet and writes the response.
+func (o handlerOptions) issueChallenge(w http.ResponseWriter, r *http.Request, challenger interface {
+	IssueChallenge(ctx context.Context, publicKey string) (Challenge, error)
+}, rawPublicKey string,
+) {
+	if rawPublicKey == "" {
 		defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
 			"code":  http.StatusBadRequest,
-			"error": err.Error(),
+			"error": "public_key is required",
 		})
 		return
 	}
 
-	if payload.PublicKey == "" {
+	publicKey, err := DecodePublicKey(rawPublicKey, EncodingAuto)
+	if err != nil {
 		defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
 			"code":  http.StatusBadRequest,
-			"error": "wallet_address is required",
+			"error": err.Error(),
 		})
 		return
 	}
+	walletAddr := base58.Encode(publicKey)
 
-	message := fmt.Sprintf(
-		"Sign this message to login as %s. Request ID: %s",
-		payload.PublicKey,
-		middleware.GetReqID(r.Context()),
-	)
+	// Check the wallet policy
+	if !o.checkWallet(w, r, walletAddr) {
+		return
+	}
+
+	// Issue a new challenge for the wallet
+	challenge, err := challenger.IssueChallenge(r.Context(), walletAddr)
+	if err != nil {
+		defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"code":  http.StatusInternalServerError,
+			"error": err.Error(),
+		})
+		return
+	}
 
 	defaultResponse(w, http.StatusOK, map[string]interface{}{
-		"message": message,
+		"message":    challenge.Message,
+		"expires_at": challenge.ExpiresAt.Unix(),
 	})
 }
 
@@ -63,6 +102,46 @@ type VerifySignedMessagePayload struct {
 	Signature string `json:"signature"`
 	// PublicKey is the public key of the sender.
 	PublicKey string `json:"public_key"`
+	// Encoding is the encoding of the signature.
+	// If it's empty, the encoding is detected automatically.
+	Encoding Encoding `json:"encoding,omitempty"`
+	// PublicKeyEncoding is the encoding of the public key.
+	// If it's empty, the encoding is detected automatically.
+	PublicKeyEncoding Encoding `json:"public_key_encoding,omitempty"`
+	// OffchainMessage is the optional base64 encoded off-chain message envelope
+	// signed by the wallet, its body must be the message.
+	// It's required if the wallet sets the application domain or other signers.
+	OffchainMessage string `json:"offchain_message,omitempty"`
+}
+
+// UnmarshalJSON unmarshals the payload.
+// The signature and the public key can be sent either as strings
+// or as arrays of byte values, e.g. serialized Uint8Array.
+func (p *VerifySignedMessagePayload) UnmarshalJSON(data []byte) error {
+	type alias VerifySignedMessagePayload
+	var raw struct {
+		alias
+		Signature json.RawMessage `json:"signature"`
+		PublicKey json.RawMessage `json:"public_key"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	signature, err := stringOrBytes(raw.Signature)
+	if err != nil {
+		return fmt.Errorf("signature must be a string or an array of bytes: %w", err)
+	}
+	publicKey, err := stringOrBytes(raw.PublicKey)
+	if err != nil {
+		return fmt.Errorf("public_key must be a string or an array of bytes: %w", err)
+	}
+
+	*p = VerifySignedMessagePayload(raw.alias)
+	p.Signature = signature
+	p.PublicKey = publicKey
+
+	return nil
 }
 
 // Validate validates the payload.
@@ -76,16 +155,130 @@ func (p *VerifySignedMessagePayload) Validate() error {
 	if p.PublicKey == "" {
 		return fmt.Errorf("public_key is required")
 	}
+	if err := p.Encoding.Validate(); err != nil {
+		return fmt.Errorf("encoding: %w", err)
+	}
+	if err := p.PublicKeyEncoding.Validate(); err != nil {
+		return fmt.Errorf("public_key_encoding: %w", err)
+	}
 	return nil
 }
 
+// HandlerOption is the option for the sign-in and refresh handlers.
+type HandlerOption func(*handlerOptions)
+
+// handlerOptions is the set of the handler options.
+type handlerOptions struct {
+	gates            []Gate
+	policy           WalletPolicy
+	maxDelegationTTL time.Duration
+}
+
+// WithGates sets the access requirements checked before issuing tokens.
+// The wallet which doesn't pass a required gate gets 403,
+// the scopes and roles granted by the gates are added to the access token.
+func WithGates(gates ...Gate) HandlerOption {
+	return func(o *handlerOptions) {
+		o.gates = append(o.gates, gates...)
+	}
+}
+
+// WithWalletPolicy sets the policy checked before issuing challenges and tokens.
+// The denied wallet gets 403 with the "error_code" field:
+// "wallet_banned" or "wallet_not_allowed".
+// Access tokens issued before the wallet was banned stay valid until they expire.
+func WithWalletPolicy(p WalletPolicy) HandlerOption {
+	return func(o *handlerOptions) {
+		o.policy = p
+	}
+}
+
+// newHandlerOptions returns the options with the defaults applied.
+func newHandlerOptions(opts ...HandlerOption) handlerOptions {
+	o := handlerOptions{
+		maxDelegationTTL: DefaultMaxDelegationTTL,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// checkWallet checks the wallet policy.
+// It writes the error response and returns false if the wallet is denied.
+func (o handlerOptions) checkWallet(w http.ResponseWriter, r *http.Request, walletAddr string) bool {
+	if o.policy == nil {
+		return true
+	}
+
+	err := o.policy.Check(r.Context(), walletAddr)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrWalletBanned):
+		defaultResponse(w, http.StatusForbidden, map[string]interface{}{
+			"code":       http.StatusForbidden,
+			"error":      err.Error(),
+			"error_code": "wallet_banned",
+		})
+	case errors.Is(err, ErrWalletNotAllowed):
+		defaultResponse(w, http.StatusForbidden, map[string]interface{}{
+			"code":       http.StatusForbidden,
+			"error":      err.Error(),
+			"error_code": "wallet_not_allowed",
+		})
+	default:
+		defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"code":  http.StatusInternalServerError,
+			"error": fmt.Sprintf("failed to check wallet policy: %s", err),
+		})
+	}
+	return false
+}
+
+// checkAccess checks the wallet policy and the gates,
+// and returns the request context with the granted scopes and roles.
+// It writes the error response and returns false if the wallet doesn't pass.
+func (o handlerOptions) checkAccess(w http.ResponseWriter, r *http.Request, walletAddr string) (context.Context, bool) {
+	if !o.checkWallet(w, r, walletAddr) {
+		return nil, false
+	}
+	if len(o.gates) == 0 {
+		return r.Context(), true
+	}
+
+	grant, err := CheckGates(r.Context(), walletAddr, o.gates...)
+	if errors.Is(err, ErrGateDenied) {
+		defaultResponse(w, http.StatusForbidden, map[string]interface{}{
+			"code":  http.StatusForbidden,
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+	if err != nil {
+		defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"code":  http.StatusInternalServerError,
+			"error": fmt.Sprintf("failed to check access requirements: %s", err),
+		})
+		return nil, false
+	}
+
+	return WithGrant(r.Context(), grant), true
+}
+
 // VerifySignedMessage is the handler for the signed message verification.
 // It verifies the signature of the message using the public key of the sender.
+// The message must be the challenge issued by RequestAuth for the same wallet,
+// each challenge can be used only once.
 // It returns access token if the signature is valid, otherwise error.
-func VerifySignedMessage(jwt interface {
-	IssueTokens(walletAddr string) (TokenResponse, error)
-},
+func VerifySignedMessage(challenger interface {
+	VerifyChallenge(ctx context.Context, publicKey, message string) error
+}, jwt interface {
+	IssueTokens(ctx context.Context, walletAddr string) (TokenResponse, error)
+}, opts ...HandlerOption,
 ) http.HandlerFunc {
+	o := newHandlerOptions(opts...)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Parse JSON request
 		var payload VerifySignedMessagePayload
@@ -97,6 +290,148 @@ func VerifySignedMessage(jwt interface {
 			return
 		}
 
+		// Verify the signature and check the access
+		ctx, walletAddr, ok := o.verifySignedMessage(w, r, challenger, payload)
+		if !ok {
+			return
+		}
+
+		// Issue tokens
+		tokens, err := jwt.IssueTokens(ctx, walletAddr)
+		if err != nil {
+			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"code":  http.StatusInternalServerError,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		defaultResponse(w, http.StatusOK, tokens)
+	}
+}
+
+// verifySignedMessage verifies the signed message, consumes the challenge
+// and checks the access of the wallet. It returns the request context
+// with the granted scopes and roles and the wallet address.
+// It writes the error response and returns false if the verification fails.
+func (o handlerOptions) verifySignedMessage(w http.ResponseWriter, r *http.Request, challenger interface {
+	VerifyChallenge(ctx context.Context, publicKey, message string) error
+}, payload VerifySignedMessagePayload,
+) (context.Context, string, bool) {
+	// Validate the payload
+	if err := payload.Validate(); err != nil {
+		defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"code":  http.StatusBadRequest,
+			"error": err.Error(),
+		})
+		return nil, "", false
+	}
+
+	// Decode the public key and the signature
+	publicKey, err := DecodePublicKey(payload.PublicKey, payload.PublicKeyEncoding)
+	if err != nil {
+		defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"code":  http.StatusBadRequest,
+			"error": err.Error(),
+		})
+		return nil, "", false
+	}
+	signature, err := DecodeSignature(payload.Signature, payload.Encoding)
+	if err != nil {
+		defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"code":  http.StatusBadRequest,
+			"error": err.Error(),
+		})
+		return nil, "", false
+	}
+	walletAddr := base58.Encode(publicKey)
+
+	// Verify the signature
+	if err := verifyPayloadSignature(payload, signature, publicKey); err != nil {
+		defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"code":  http.StatusBadRequest,
+			"error": err.Error(),
+		})
+		return nil, "", false
+	}
+
+	// Consume the challenge
+	if err := challenger.VerifyChallenge(r.Context(), walletAddr, payload.Message); err != nil {
+		defaultResponse(w, http.StatusUnauthorized, map[string]interface{}{
+			"code":  http.StatusUnauthorized,
+			"error": err.Error(),
+		})
+		return nil, "", false
+	}
+
+	// Check the wallet policy and the access requirements
+	ctx, ok := o.checkAccess(w, r, walletAddr)
+	if !ok {
+		return nil, "", false
+	}
+
+	return ctx, walletAddr, true
+}
+
+// verifyPayloadSignature verifies the signature of the message
+// or of the off-chain message envelope if the payload has it.
+func verifyPayloadSignature(payload VerifySignedMessagePayload, signature, publicKey []byte) error {
+	if payload.OffchainMessage == "" {
+		_, err := VerifyMessageSignature(payload.Message, signature, publicKey)
+		return err
+	}
+
+	envelope, err := base64.StdEncoding.DecodeString(payload.OffchainMessage)
+	if err != nil {
+		return fmt.Errorf("offchain_message must be base64 encoded: %w", err)
+	}
+	_, err = VerifyOffchainEnvelope(payload.Message, envelope, signature, publicKey)
+	return err
+}
+
+// VerifySignedTransactionPayload is the payload for the signed transaction verification.
+type VerifySignedTransactionPayload struct {
+	// Transaction is the base64 encoded serialized transaction signed by the wallet.
+	Transaction string `json:"transaction"`
+	// PublicKey is the public key of the sender.
+	PublicKey string `json:"public_key"`
+}
+
+// Validate validates the payload.
+func (p *VerifySignedTransactionPayload) Validate() error {
+	if p.Transaction == "" {
+		return fmt.Errorf("transaction is required")
+	}
+	if p.PublicKey == "" {
+		return fmt.Errorf("public_key is required")
+	}
+	return nil
+}
+
+// VerifySignedTransaction is the handler for the wallets which can sign transactions only.
+// It verifies the never-broadcast transaction signed by the wallet,
+// which contains the challenge issued by RequestAuth in a Memo instruction.
+// See VerifyAuthTransaction for the transaction requirements.
+// It returns access token if the transaction is valid, otherwise error.
+func VerifySignedTransaction(challenger interface {
+	VerifyChallenge(ctx context.Context, publicKey, message string) error
+}, jwt interface {
+	IssueTokens(ctx context.Context, walletAddr string) (TokenResponse, error)
+}, opts ...HandlerOption,
+) http.HandlerFunc {
+	o := newHandlerOptions(opts...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse JSON request
+		var payload VerifySignedTransactionPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
 		// Validate the payload
 		if err := payload.Validate(); err != nil {
 			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
@@ -106,17 +441,52 @@ func VerifySignedMessage(jwt interface {
 			return
 		}
 
-		// Verify the signature
-		if err := VerifySignature(payload.Message, payload.Signature, payload.PublicKey); err != nil {
+		publicKey, err := DecodePublicKey(payload.PublicKey, EncodingAuto)
+		if err != nil {
 			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
 				"code":  http.StatusBadRequest,
 				"error": err.Error(),
 			})
 			return
 		}
+		walletAddr := base58.Encode(publicKey)
+
+		rawTx, err := base64.StdEncoding.DecodeString(payload.Transaction)
+		if err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": fmt.Sprintf("can't decode base64 transaction: %s", err),
+			})
+			return
+		}
+
+		// Verify the transaction and get the challenge from its memo
+		message, err := VerifyAuthTransaction(rawTx, walletAddr)
+		if err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Consume the challenge
+		if err := challenger.VerifyChallenge(r.Context(), walletAddr, message); err != nil {
+			defaultResponse(w, http.StatusUnauthorized, map[string]interface{}{
+				"code":  http.StatusUnauthorized,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Check the wallet policy and the access requirements
+		ctx, ok := o.checkAccess(w, r, walletAddr)
+		if !ok {
+			return
+		}
 
 		// Issue tokens
-		tokens, err := jwt.IssueTokens(payload.PublicKey)
+		tokens, err := jwt.IssueTokens(ctx, walletAddr)
 		if err != nil {
 			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
 				"code":  http.StatusInternalServerError,
@@ -137,10 +507,16 @@ type RefreshTokenPayload struct {
 
 // RefreshToken is the handler for the refresh token.
 // It refreshes the access token.
+// If the wallet policy or the gates are set, they are checked again,
+// so the banned wallet or the one which doesn't meet the requirements anymore
+// can't refresh tokens.
 func RefreshToken(jwt interface {
-	RefreshToken(tokenString string) (TokenResponse, error)
-},
+	VerifyRefreshToken(tokenString string) (*Claims, error)
+	RefreshToken(ctx context.Context, tokenString string) (TokenResponse, error)
+}, opts ...HandlerOption,
 ) http.HandlerFunc {
+	o := newHandlerOptions(opts...)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Parse JSON request
 		var payload RefreshTokenPayload
@@ -161,16 +537,41 @@ func RefreshToken(jwt interface {
 			return
 		}
 
+		// Check the wallet policy and the access requirements
+		ctx := r.Context()
+		if o.policy != nil || len(o.gates) > 0 {
+			claims, err := jwt.VerifyRefreshToken(payload.RefreshToken)
+			if err != nil {
+				refreshTokenError(w, err)
+				return
+			}
+
+			var ok bool
+			if ctx, ok = o.checkAccess(w, r, claims.Wallet); !ok {
+				return
+			}
+		}
+
 		// Refresh the token
-		tokens, err := jwt.RefreshToken(payload.RefreshToken)
+		tokens, err := jwt.RefreshToken(ctx, payload.RefreshToken)
 		if err != nil {
-			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
-				"code":  http.StatusInternalServerError,
-				"error": err.Error(),
-			})
+			refreshTokenError(w, err)
 			return
 		}
 
 		defaultResponse(w, http.StatusOK, tokens)
 	}
 }
+
+// refreshTokenError writes the error response of the token refresh:
+// 401 if the refresh token is rejected and 500 if a store or the RPC fails.
+func refreshTokenError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if isTokenRejected(err) {
+		status = http.StatusUnauthorized
+	}
+	defaultResponse(w, status, map[string]interface{}{
+		"code":  status,
+		"error": err.Error(),
+	})
+}
@@ -2,12 +2,13 @@ package solauth_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/dmitrymomot/solauth"
 	"github.com/portto/solana-go-sdk/types"
@@ -31,7 +32,7 @@ func TestRequestAuth(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	solauth.RequestAuth(rr, req)
+	solauth.RequestAuth(solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0))(rr, req)
 
 	res := rr.Result()
 	defer res.Body.Close()
@@ -42,43 +43,67 @@ func TestRequestAuth(t *testing.T) {
 	err = json.NewDecoder(res.Body).Decode(&response)
 	require.NoError(t, err)
 	require.NotEmpty(t, response["message"])
+	require.NotEmpty(t, response["expires_at"])
 }
 
 func TestVerifySignedMessage(t *testing.T) {
-	message := "test message"
-	signature := wallet.Sign([]byte(message))
+	challenger := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0)
+	handler := solauth.VerifySignedMessage(challenger, solauth.NewJWT(authSigningKey))
 
-	reqData := solauth.VerifySignedMessagePayload{
-		Message:   message,
-		Signature: base64.StdEncoding.EncodeToString(signature),
-		PublicKey: wallet.PublicKey.ToBase58(),
-	}
-	jsonData, err := json.Marshal(reqData)
+	challenge, err := challenger.IssueChallenge(context.Background(), wallet.PublicKey.ToBase58())
 	require.NoError(t, err)
 
-	req := httptest.NewRequest(http.MethodPost, "/auth/verify", bytes.NewReader(jsonData))
-	req.Header.Set("Content-Type", "application/json")
+	verify := func(message string) *http.Response {
+		signature := wallet.Sign([]byte(message))
 
-	rr := httptest.NewRecorder()
+		reqData := solauth.VerifySignedMessagePayload{
+			Message:   message,
+			Signature: base64.StdEncoding.EncodeToString(signature),
+			PublicKey: wallet.PublicKey.ToBase58(),
+		}
+		jsonData, err := json.Marshal(reqData)
+		require.NoError(t, err)
 
-	solauth.VerifySignedMessage(solauth.NewJWT(authSigningKey))(rr, req)
+		req := httptest.NewRequest(http.MethodPost, "/auth/verify", bytes.NewReader(jsonData))
+		req.Header.Set("Content-Type", "application/json")
 
-	res := rr.Result()
-	defer res.Body.Close()
+		rr := httptest.NewRecorder()
+		handler(rr, req)
 
-	require.Equal(t, http.StatusOK, res.StatusCode)
+		return rr.Result()
+	}
 
-	response := make(map[string]interface{})
-	err = json.NewDecoder(res.Body).Decode(&response)
-	require.NoError(t, err)
-	require.NotEmpty(t, response["access_token"])
-	require.NotEmpty(t, response["refresh_token"])
-	require.NotEmpty(t, response["expires_in"])
-	fmt.Println(response["access_token"])
+	t.Run("issued challenge", func(t *testing.T) {
+		res := verify(challenge.Message)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		response := make(map[string]interface{})
+		err = json.NewDecoder(res.Body).Decode(&response)
+		require.NoError(t, err)
+		require.NotEmpty(t, response["access_token"])
+		require.NotEmpty(t, response["refresh_token"])
+		require.NotEmpty(t, response["expires_in"])
+	})
+
+	t.Run("replayed challenge", func(t *testing.T) {
+		res := verify(challenge.Message)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("arbitrary message", func(t *testing.T) {
+		res := verify("test message")
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
 }
 
 func TestRefreshToken(t *testing.T) {
-	tokens, err := solauth.NewJWT(authSigningKey).IssueTokens(wallet.PublicKey.ToBase58())
+	tokens, err := solauth.NewJWT(authSigningKey).IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
 	require.NoError(t, err)
 
 	reqData := solauth.RefreshTokenPayload{
@@ -105,4 +130,29 @@ func TestRefreshToken(t *testing.T) {
 	require.NotEmpty(t, response["access_token"])
 	require.NotEmpty(t, response["refresh_token"])
 	require.NotEmpty(t, response["expires_in"])
+
+	t.Run("errors", func(t *testing.T) {
+		refresh := func(j *solauth.JWT, token string) int {
+			jsonData, err := json.Marshal(solauth.RefreshTokenPayload{RefreshToken: token})
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			solauth.RefreshToken(j)(rr, httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewReader(jsonData)))
+			return rr.Code
+		}
+		j := solauth.NewJWT(authSigningKey)
+
+		expired, err := solauth.NewJWT(authSigningKey, solauth.WithRefreshTTL(-time.Minute)).IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+		require.NoError(t, err)
+		other, err := solauth.NewJWT([]byte("another secret")).IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusUnauthorized, refresh(j, expired.Refresh))
+		require.Equal(t, http.StatusUnauthorized, refresh(j, other.Refresh))
+		require.Equal(t, http.StatusUnauthorized, refresh(j, tokens.Access))
+		require.Equal(t, http.StatusUnauthorized, refresh(j, "invalid"))
+
+		// the store failure is not the client's fault
+		failing := solauth.NewJWT(authSigningKey, solauth.WithRevocationStore(failingRevocationStore{}))
+		require.Equal(t, http.StatusInternalServerError, refresh(failing, tokens.Refresh))
+	})
 }
@@ -0,0 +1,122 @@
+package solauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// ClientCredentials is the set of client IDs and secrets
+// allowed to call the introspection endpoint.
+type ClientCredentials map[string]string
+
+// ParseClientCredentials parses the list of "id:secret" pairs.
+func ParseClientCredentials(list []string) (ClientCredentials, error) {
+	clients := make(ClientCredentials, len(list))
+	for _, item := range list {
+		id, secret, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || id == "" || secret == "" {
+			return nil, ErrInvalidClientCredentials
+		}
+		clients[id] = secret
+	}
+	return clients, nil
+}
+
+// Authenticate reports whether the client secret is valid.
+func (c ClientCredentials) Authenticate(clientID, clientSecret string) bool {
+	secret, ok := c[clientID]
+	match := subtle.ConstantTimeCompare([]byte(secret), []byte(clientSecret)) == 1
+	return ok && match
+}
+
+// IntrospectionResponse is the token introspection response (RFC 7662).
+// Only Active is set for the inactive tokens.
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Wallet    string   `json:"wallet,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+}
+
+// NewIntrospectionResponse creates the introspection response of the active token.
+func NewIntrospectionResponse(claims *Claims) IntrospectionResponse {
+	resp := IntrospectionResponse{
+		Active:    true,
+		Wallet:    claims.Wallet,
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		TokenID:   claims.ID,
+		Scope:     strings.Join(claims.Scopes, " "),
+		Roles:     claims.Roles,
+		TokenType: claims.TokenType(),
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	return resp
+}
+
+// Introspect is the token introspection endpoint (RFC 7662)
+// for the services and API gateways which validate tokens by calling the server.
+// The caller must authenticate with the client credentials using HTTP Basic auth.
+// It accepts the form encoded "token" parameter and responds with the token claims,
+// or with {"active": false} if the token is invalid, expired or revoked.
+// Refresh tokens are also inactive once they are rotated or their family is revoked.
+// If the token state can't be checked, e.g. the revocation store fails,
+// it responds with 503 instead of reporting the token as inactive.
+func Introspect(jwt interface {
+	IntrospectToken(ctx context.Context, tokenString string) (*Claims, error)
+}, clients interface {
+	Authenticate(clientID, clientSecret string) bool
+},
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || !clients.Authenticate(clientID, clientSecret) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="introspect"`)
+			defaultResponse(w, http.StatusUnauthorized, map[string]interface{}{
+				"error":             "invalid_client",
+				"error_description": ErrInvalidClientCredentials.Error(),
+			})
+			return
+		}
+
+		token := r.PostFormValue("token")
+		if token == "" {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"error":             "invalid_request",
+				"error_description": "token is required",
+			})
+			return
+		}
+
+		claims, err := jwt.IntrospectToken(r.Context(), token)
+		if err != nil && isTokenRejected(err) {
+			defaultResponse(w, http.StatusOK, IntrospectionResponse{Active: false})
+			return
+		}
+		if err != nil {
+			// The token state is unknown, e.g. the revocation store is unavailable
+			defaultResponse(w, http.StatusServiceUnavailable, map[string]interface{}{
+				"error":             "temporarily_unavailable",
+				"error_description": err.Error(),
+			})
+			return
+		}
+
+		defaultResponse(w, http.StatusOK, NewIntrospectionResponse(claims))
+	}
+}
@@ -0,0 +1,146 @@
+package solauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospect(t *testing.T) {
+	ctx := context.Background()
+	j := solauth.NewJWT(authSigningKey,
+		solauth.WithIssuer("https://auth.example.com"),
+		solauth.WithRevocationStore(solauth.NewMemoryRevocationStore()),
+	)
+	clients, err := solauth.ParseClientCredentials([]string{"gateway:s3cret"})
+	require.NoError(t, err)
+	handler := solauth.Introspect(j, clients)
+
+	tokens, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	introspect := func(token, clientID, secret string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if clientID != "" {
+			req.SetBasicAuth(clientID, secret)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+
+		var resp map[string]interface{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		return rr.Code, resp
+	}
+
+	code, resp := introspect(tokens.Access, "gateway", "s3cret")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, true, resp["active"])
+	require.Equal(t, wallet.PublicKey.ToBase58(), resp["wallet"])
+	require.Equal(t, wallet.PublicKey.ToBase58(), resp["sub"])
+	require.Equal(t, "https://auth.example.com", resp["iss"])
+	require.Equal(t, solauth.TokenTypeAccess, resp["token_type"])
+	require.NotEmpty(t, resp["jti"])
+	require.NotEmpty(t, resp["exp"])
+	require.NotEmpty(t, resp["iat"])
+	require.Nil(t, resp["aud"])
+
+	code, resp = introspect(tokens.Refresh, "gateway", "s3cret")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, solauth.TokenTypeRefresh, resp["token_type"])
+
+	t.Run("inactive", func(t *testing.T) {
+		code, resp := introspect("invalid", "gateway", "s3cret")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, map[string]interface{}{"active": false}, resp)
+
+		require.NoError(t, j.RevokeToken(ctx, tokens.Access))
+		code, resp = introspect(tokens.Access, "gateway", "s3cret")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, map[string]interface{}{"active": false}, resp)
+	})
+
+	t.Run("rotated refresh token", func(t *testing.T) {
+		j := solauth.NewJWT(authSigningKey, solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()))
+		defer func(h http.HandlerFunc) { handler = h }(handler)
+		handler = solauth.Introspect(j, clients)
+
+		tokens, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+		require.NoError(t, err)
+		_, resp := introspect(tokens.Refresh, "gateway", "s3cret")
+		require.Equal(t, true, resp["active"])
+
+		rotated, err := j.RefreshToken(ctx, tokens.Refresh)
+		require.NoError(t, err)
+		_, resp = introspect(tokens.Refresh, "gateway", "s3cret")
+		require.Equal(t, map[string]interface{}{"active": false}, resp)
+		_, resp = introspect(rotated.Refresh, "gateway", "s3cret")
+		require.Equal(t, true, resp["active"])
+
+		// the reuse revokes the family
+		_, err = j.RefreshToken(ctx, tokens.Refresh)
+		require.ErrorIs(t, err, solauth.ErrRefreshTokenReused)
+		_, resp = introspect(rotated.Refresh, "gateway", "s3cret")
+		require.Equal(t, map[string]interface{}{"active": false}, resp)
+
+		// access tokens are not tracked in the families
+		_, resp = introspect(rotated.Access, "gateway", "s3cret")
+		require.Equal(t, true, resp["active"])
+	})
+
+	t.Run("revocation store failure", func(t *testing.T) {
+		j := solauth.NewJWT(authSigningKey, solauth.WithRevocationStore(failingRevocationStore{}))
+		defer func(h http.HandlerFunc) { handler = h }(handler)
+		handler = solauth.Introspect(j, clients)
+
+		code, resp := introspect(tokens.Access, "gateway", "s3cret")
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, "temporarily_unavailable", resp["error"])
+
+		// the invalid token is still inactive
+		code, resp = introspect("invalid", "gateway", "s3cret")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, map[string]interface{}{"active": false}, resp)
+	})
+
+	t.Run("client authentication", func(t *testing.T) {
+		code, resp := introspect(tokens.Refresh, "", "")
+		require.Equal(t, http.StatusUnauthorized, code)
+		require.Equal(t, "invalid_client", resp["error"])
+
+		code, _ = introspect(tokens.Refresh, "gateway", "wrong")
+		require.Equal(t, http.StatusUnauthorized, code)
+
+		code, _ = introspect(tokens.Refresh, "unknown", "")
+		require.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		code, resp := introspect("", "gateway", "s3cret")
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, "invalid_request", resp["error"])
+	})
+
+	_, err = solauth.ParseClientCredentials([]string{"gateway"})
+	require.ErrorIs(t, err, solauth.ErrInvalidClientCredentials)
+}
+
+// failingRevocationStore is the revocation store which is unavailable.
+type failingRevocationStore struct{}
+
+func (failingRevocationStore) Revoke(context.Context, string, time.Time) error {
+	return errors.New("store is unavailable")
+}
+
+func (failingRevocationStore) IsRevoked(context.Context, string) (bool, error) {
+	return false, errors.New("store is unavailable")
+}
@@ -0,0 +1,238 @@
+package solauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWK is the JSON Web Key (RFC 7517) of the public key to verify tokens.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// Key returns the verification key from the JSON Web Key.
+// The key ID is taken from the "kid" member.
+func (k JWK) Key() (Key, error) {
+	var (
+		key Key
+		err error
+	)
+
+	switch k.Kty {
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return Key{}, fmt.Errorf("unsupported OKP curve: %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return Key{}, fmt.Errorf("invalid Ed25519 public key")
+		}
+		key, err = NewPublicKey(ed25519.PublicKey(x))
+		if err != nil {
+			return Key{}, err
+		}
+	case "EC":
+		if k.Crv != elliptic.P256().Params().Name {
+			return Key{}, fmt.Errorf("unsupported EC curve: %q", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return Key{}, fmt.Errorf("invalid EC public key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return Key{}, fmt.Errorf("invalid EC public key: point is not on curve")
+		}
+		key, err = NewPublicKey(pub)
+		if err != nil {
+			return Key{}, err
+		}
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return Key{}, fmt.Errorf("invalid RSA public key")
+		}
+		key, err = NewPublicKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())})
+		if err != nil {
+			return Key{}, err
+		}
+	default:
+		return Key{}, fmt.Errorf("unsupported key type: %q", k.Kty)
+	}
+
+	if k.Alg != "" && k.Alg != key.Algorithm() {
+		return Key{}, fmt.Errorf("key algorithm mismatch: %q, expected %q", k.Alg, key.Algorithm())
+	}
+	key.ID = k.Kid
+
+	return key, nil
+}
+
+// JWKS is the JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK creates the JSON Web Key from the public part of the key.
+// It returns error for the symmetric keys, they must never be published.
+func NewJWK(key Key) (JWK, error) {
+	jwk := JWK{
+		Kid: key.ID,
+		Use: "sig",
+		Alg: key.Algorithm(),
+	}
+
+	switch k := key.PublicKey().(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	default:
+		return JWK{}, fmt.Errorf("key %q has no public key to publish", key.ID)
+	}
+
+	return jwk, nil
+}
+
+// JWKS returns the public keys of all non-retired asymmetric keys of the keyring.
+func (kr *Keyring) JWKS(now time.Time) JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range kr.keys {
+		if k.Symmetric() || k.Retired(now) {
+			continue
+		}
+		if jwk, err := NewJWK(k); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+// Algorithms returns the signing algorithms of all non-retired keys of the keyring.
+func (kr *Keyring) Algorithms(now time.Time) []string {
+	algs := []string{}
+	seen := make(map[string]bool)
+	for _, k := range kr.keys {
+		if k.Retired(now) || seen[k.Algorithm()] {
+			continue
+		}
+		seen[k.Algorithm()] = true
+		algs = append(algs, k.Algorithm())
+	}
+	return algs
+}
+
+// JWKSHandler is the handler for the JSON Web Key Set endpoint,
+// usually mounted to /.well-known/jwks.json.
+// It serves the public keys of the current keyring, so other services
+// can verify tokens without the signing material.
+func JWKSHandler(j interface {
+	Keyring() *Keyring
+},
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defaultResponse(w, http.StatusOK, j.Keyring().JWKS(time.Now()))
+	}
+}
+
+// DiscoveryDocument is the OpenID Connect Discovery-like metadata of the server.
+type DiscoveryDocument struct {
+	// Issuer is the URL of the server, the "iss" claim of the issued tokens.
+	Issuer string `json:"issuer"`
+	// JWKSURI is the URL of the JSON Web Key Set.
+	JWKSURI string `json:"jwks_uri"`
+	// ChallengeEndpoint is the URL to request the message to sign.
+	ChallengeEndpoint string `json:"challenge_endpoint"`
+	// TokenEndpoint is the URL to exchange the signed message for tokens.
+	TokenEndpoint string `json:"token_endpoint"`
+	// TransactionTokenEndpoint is the URL to exchange the signed transaction for tokens.
+	TransactionTokenEndpoint string `json:"transaction_token_endpoint,omitempty"`
+	// RefreshEndpoint is the URL to refresh tokens.
+	RefreshEndpoint string `json:"refresh_endpoint"`
+	// RevocationEndpoint is the URL to revoke tokens (RFC 7009).
+	RevocationEndpoint string `json:"revocation_endpoint,omitempty"`
+	// IntrospectionEndpoint is the URL to introspect tokens (RFC 7662).
+	// It's set only if the introspection is enabled.
+	IntrospectionEndpoint string `json:"introspection_endpoint,omitempty"`
+	// LogoutEndpoint is the URL to end the current session.
+	LogoutEndpoint string `json:"logout_endpoint,omitempty"`
+	// TokenSigningAlgValuesSupported is the list of the token signing algorithms.
+	// It's filled from the keyring by DiscoveryHandler.
+	TokenSigningAlgValuesSupported []string `json:"token_signing_alg_values_supported"`
+	// SignatureSchemesSupported is the list of the forms the wallet can sign the challenge in.
+	SignatureSchemesSupported []string `json:"signature_schemes_supported"`
+	// SignatureEncodingsSupported is the list of the supported signature encodings.
+	SignatureEncodingsSupported []string `json:"signature_encodings_supported"`
+	// MessageFormat is the format of the challenge message: "plain" or "siws".
+	MessageFormat string `json:"message_format,omitempty"`
+}
+
+// NewDiscoveryDocument creates the discovery document
+// with the default endpoints relative to the issuer URL.
+func NewDiscoveryDocument(issuer string) DiscoveryDocument {
+	base := strings.TrimSuffix(issuer, "/")
+	return DiscoveryDocument{
+		Issuer:                   issuer,
+		JWKSURI:                  base + "/.well-known/jwks.json",
+		ChallengeEndpoint:        base + "/auth/request",
+		TokenEndpoint:            base + "/auth/verify",
+		TransactionTokenEndpoint: base + "/auth/verify/transaction",
+		RefreshEndpoint:          base + "/auth/refresh",
+		RevocationEndpoint:       base + "/auth/revoke",
+		LogoutEndpoint:           base + "/auth/logout",
+		SignatureSchemesSupported: []string{
+			string(SignatureSchemeRaw),
+			string(SignatureSchemeOffchain),
+			string(SignatureSchemeTransaction),
+		},
+		SignatureEncodingsSupported: []string{
+			string(EncodingBase58),
+			string(EncodingBase64),
+			string(EncodingBase64URL),
+			string(EncodingHex),
+			string(EncodingBytes),
+		},
+	}
+}
+
+// DiscoveryHandler is the handler for the discovery document,
+// usually mounted to /.well-known/openid-configuration.
+// The supported signing algorithms are taken from the current keyring.
+func DiscoveryHandler(doc DiscoveryDocument, j interface {
+	Keyring() *Keyring
+},
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d := doc
+		d.TokenSigningAlgValuesSupported = j.Keyring().Algorithms(time.Now())
+		defaultResponse(w, http.StatusOK, d)
+	}
+}
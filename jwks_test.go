@@ -0,0 +1,58 @@
+package solauth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signingKey, err := solauth.NewPrivateKey(edKey)
+	require.NoError(t, err)
+	signingKey.ID = "ed25519"
+
+	keyring, err := solauth.NewKeyring(signingKey, solauth.NewHMACKey(authSigningKey))
+	require.NoError(t, err)
+	j := solauth.NewJWTWithKeyring(keyring)
+
+	t.Run("jwks", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		solauth.JWKSHandler(j)(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var set solauth.JWKS
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&set))
+
+		// The shared secret must never be published
+		require.Len(t, set.Keys, 1)
+		require.Equal(t, "ed25519", set.Keys[0].Kid)
+		require.Equal(t, "OKP", set.Keys[0].Kty)
+		require.Equal(t, "Ed25519", set.Keys[0].Crv)
+		require.Equal(t, solauth.AlgEdDSA, set.Keys[0].Alg)
+		require.NotEmpty(t, set.Keys[0].X)
+	})
+
+	t.Run("discovery", func(t *testing.T) {
+		doc := solauth.NewDiscoveryDocument("https://auth.example.com/")
+
+		rr := httptest.NewRecorder()
+		solauth.DiscoveryHandler(doc, j)(rr, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		response := make(map[string]interface{})
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		require.Equal(t, "https://auth.example.com/.well-known/jwks.json", response["jwks_uri"])
+		require.Equal(t, "https://auth.example.com/auth/verify", response["token_endpoint"])
+		require.ElementsMatch(t, []interface{}{solauth.AlgEdDSA, solauth.AlgHS256}, response["token_signing_alg_values_supported"])
+		require.Contains(t, response["signature_schemes_supported"], "offchain")
+	})
+}
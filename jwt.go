@@ -1,31 +1,238 @@
 package solauth
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// Default token lifetimes.
+const (
+	DefaultAccessTokenTTL  = time.Hour
+	DefaultRefreshTokenTTL = time.Hour * 24 * 7
+)
+
+// Token types, the values of the "typ" claim.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
 // JWT is the interactor for JWT.
 type JWT struct {
-	signingKey []byte
+	keyring    atomic.Pointer[Keyring]
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	validation TokenValidation
+	refresh    RefreshTokenStore
+	revocation RevocationStore
+	onEvent    SecurityEventHandler
+	roles      RoleResolver
+	enricher   ClaimsEnricher
+	multisigs  RPCClient
+}
+
+// JWTOption is the option for the JWT interactor.
+type JWTOption func(*JWT)
+
+// WithAccessTTL sets the lifetime of access tokens.
+// Default is DefaultAccessTokenTTL.
+func WithAccessTTL(ttl time.Duration) JWTOption {
+	return func(j *JWT) {
+		j.accessTTL = ttl
+	}
+}
+
+// WithRefreshTTL sets the lifetime of refresh tokens.
+// Default is DefaultRefreshTokenTTL.
+func WithRefreshTTL(ttl time.Duration) JWTOption {
+	return func(j *JWT) {
+		j.refreshTTL = ttl
+	}
+}
+
+// WithIssuer sets the "iss" claim of issued tokens.
+// Tokens of another issuer are rejected by VerifyToken.
+func WithIssuer(issuer string) JWTOption {
+	return func(j *JWT) {
+		j.validation.Issuer = issuer
+	}
+}
+
+// WithAudience sets the "aud" claim of issued tokens.
+// Tokens for none of these audiences are rejected by VerifyToken.
+func WithAudience(audience ...string) JWTOption {
+	return func(j *JWT) {
+		j.validation.Audience = audience
+	}
+}
+
+// WithLeeway sets the allowed clock skew for the "exp", "nbf" and "iat" claims.
+func WithLeeway(leeway time.Duration) JWTOption {
+	return func(j *JWT) {
+		j.validation.Leeway = leeway
+	}
+}
+
+// WithRefreshTokenStore enables refresh token rotation.
+// Every refresh invalidates the presented refresh token, and presenting
+// an already rotated token revokes the whole token family.
+// The access tokens of the revoked family are rejected only if token revocation
+// is enabled as well (see WithRevocationStore), otherwise they stay valid until they expire.
+func WithRefreshTokenStore(store RefreshTokenStore) JWTOption {
+	return func(j *JWT) {
+		j.refresh = store
+	}
+}
+
+// WithRevocationStore enables token revocation.
+// VerifyToken rejects the tokens revoked with RevokeToken or RevokeSession.
+// Wrap the shared store with NewCachedRevocationStore to keep verification fast.
+func WithRevocationStore(store RevocationStore) JWTOption {
+	return func(j *JWT) {
+		j.revocation = store
+	}
 }
 
-// NewJWT creates a new JWT interactor.
-func NewJWT(signingKey []byte) *JWT {
-	return &JWT{
-		signingKey: signingKey,
+// WithRoleResolver sets the resolver of the scopes and roles
+// added to the access tokens of the wallet.
+func WithRoleResolver(r RoleResolver) JWTOption {
+	return func(j *JWT) {
+		j.roles = r
 	}
 }
 
+// WithClaimsEnricher sets the source of the custom claims
+// added to the access tokens of the wallet.
+func WithClaimsEnricher(e ClaimsEnricher) JWTOption {
+	return func(j *JWT) {
+		j.enricher = e
+	}
+}
+
+// WithMultisigClient sets the RPC client to fetch the Squads multisig accounts with
+// on refresh of the vault tokens, so the signers are checked against the current
+// members and threshold. Without it the tokens of multisig vaults can't be refreshed.
+func WithMultisigClient(client RPCClient) JWTOption {
+	return func(j *JWT) {
+		j.multisigs = client
+	}
+}
+
+// WithSecurityEventHandler sets the handler of the security events,
+// e.g. refresh token reuse.
+func WithSecurityEventHandler(h SecurityEventHandler) JWTOption {
+	return func(j *JWT) {
+		j.onEvent = h
+	}
+}
+
+// TokenValidation is the set of the claim checks applied on token verification.
+type TokenValidation struct {
+	// Issuer is the expected "iss" claim, not checked if empty.
+	Issuer string
+	// Audience is the list of the accepted audiences,
+	// the token must be issued for at least one of them. Not checked if empty.
+	Audience []string
+	// Leeway is the allowed clock skew for the time based claims.
+	Leeway time.Duration
+}
+
+// NewJWT creates a new JWT interactor
+// which signs tokens with the shared HMAC secret (HS256).
+func NewJWT(signingKey []byte, opts ...JWTOption) *JWT {
+	return NewJWTWithKey(NewHMACKey(signingKey), opts...)
+}
+
+// NewJWTWithKey creates a new JWT interactor with the given key.
+// If the key is a public key, the interactor can verify tokens only.
+func NewJWTWithKey(key Key, opts ...JWTOption) *JWT {
+	return NewJWTWithKeyring(&Keyring{keys: []Key{key}}, opts...)
+}
+
+// NewJWTWithKeyring creates a new JWT interactor with the given keyring.
+func NewJWTWithKeyring(kr *Keyring, opts ...JWTOption) *JWT {
+	j := &JWT{
+		accessTTL:  DefaultAccessTokenTTL,
+		refreshTTL: DefaultRefreshTokenTTL,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	j.keyring.Store(kr)
+	return j
+}
+
+// NewJWTFromPEM creates a new JWT interactor from PEM encoded key.
+// With the private key (Ed25519, ECDSA P-256 or RSA) it signs tokens
+// with the matching algorithm (EdDSA, ES256 or RS256).
+// With the public key the interactor can verify tokens only,
+// so downstream services don't need any signing material.
+func NewJWTFromPEM(data []byte, opts ...JWTOption) (*JWT, error) {
+	key, err := ParseKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewJWTWithKey(key, opts...), nil
+}
+
+// Keyring returns the current keyring of the interactor.
+func (j *JWT) Keyring() *Keyring {
+	return j.keyring.Load()
+}
+
+// SetKeyring replaces the keyring of the interactor.
+// It's safe to call concurrently with issuing and verifying tokens,
+// e.g. to reload keys on SIGHUP.
+func (j *JWT) SetKeyring(kr *Keyring) {
+	j.keyring.Store(kr)
+}
+
 // Claims is the claims for the token.
 type Claims struct {
 	Wallet string `json:"wallet"`
+	// Type is the token type: TokenTypeAccess or TokenTypeRefresh.
+	Type string `json:"typ,omitempty"`
+	// Family is the ID of the refresh token family the token belongs to.
+	// It's set only if refresh token rotation is enabled.
+	Family string `json:"fid,omitempty"`
+	// Scopes is the list of the scopes granted to the wallet.
+	// In the refresh token of the session key it's the list of the delegated scopes.
+	Scopes []string `json:"scopes,omitempty"`
+	// Roles is the list of the roles granted to the wallet.
+	Roles []string `json:"roles,omitempty"`
+	// Multisig is the address of the multisig account if the wallet is its vault.
+	Multisig string `json:"msig,omitempty"`
+	// Signers is the list of the multisig members who signed in.
+	Signers []string `json:"signers,omitempty"`
+	// SessionKey is the session key delegated by the wallet if the token is issued for it.
+	SessionKey string `json:"sk,omitempty"`
+	// Extra is the custom claims added by the ClaimsEnricher.
+	// They are encoded as the top-level claims of the token.
+	Extra map[string]interface{} `json:"-"`
 	jwt.RegisteredClaims
 }
 
+// TokenType returns the type of the token: TokenTypeAccess or TokenTypeRefresh.
+// Tokens issued before the "typ" claim was introduced
+// have the type in the "aud" claim.
+func (c *Claims) TokenType() string {
+	if c.Type != "" {
+		return c.Type
+	}
+	for _, typ := range []string{TokenTypeAccess, TokenTypeRefresh} {
+		if hasAudience(c.Audience, typ) {
+			return typ
+		}
+	}
+	return ""
+}
+
 // TokenResponse is the response for the token request.
 type TokenResponse struct {
 	Access    string `json:"access_token"`
@@ -35,88 +242,460 @@ type TokenResponse struct {
 
 // IssueToken issues a token for the user.
 // This function generates a token for the user and returns it.
-func (j *JWT) IssueTokens(walletAddr string) (TokenResponse, error) {
-	accessID := uuid.New().String()
-	accessExpAt := time.Now().Add(time.Hour * 1).Unix() // 1 hour
+// The access token has the scopes and roles of the RoleResolver
+// and of the grant in the context (see WithGrant).
+// If refresh token rotation is enabled, it starts a new token family.
+func (j *JWT) IssueTokens(ctx context.Context, walletAddr string) (TokenResponse, error) {
+	var family string
+	if j.refresh != nil {
+		family = uuid.New().String()
+	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		Wallet: walletAddr,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ID:        accessID,
-			Audience:  jwt.ClaimStrings{"access"},
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Unix(accessExpAt, 0)),
-		},
-	})
+	tokens, refreshClaims, err := j.issueTokens(ctx, walletAddr, family)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if j.refresh != nil {
+		if err := j.refresh.Create(ctx, family, refreshClaims.ID, refreshClaims.ExpiresAt.Time); err != nil {
+			return TokenResponse{}, fmt.Errorf("failed to save refresh token: %w", err)
+		}
+	}
+
+	return tokens, nil
+}
+
+// issueTokens issues the token pair of the given family
+// and returns it with the claims of the refresh token.
+func (j *JWT) issueTokens(ctx context.Context, walletAddr, family string) (TokenResponse, Claims, error) {
+	now := time.Now()
+
+	key, err := j.Keyring().SigningKey(now)
+	if err != nil {
+		return TokenResponse{}, Claims{}, err
+	}
+
+	accessTTL, refreshTTL := j.accessTTL, j.refreshTTL
+	session, isSession := sessionDelegationFromContext(ctx)
+	if isSession {
+		if !now.Before(session.expiresAt) {
+			return TokenResponse{}, Claims{}, ErrDelegationExpired
+		}
+		accessTTL = session.limitTTL(now, accessTTL)
+		refreshTTL = session.limitTTL(now, refreshTTL)
+	}
+
+	msig := multisigSignersFromContext(ctx)
+	accessClaims := j.newClaims(walletAddr, family, TokenTypeAccess, now, accessTTL)
+	accessClaims.Multisig, accessClaims.Signers = msig.multisig, msig.signers
+	grant := GrantFromContext(ctx)
+	if j.roles != nil {
+		resolved, err := j.roles.Resolve(ctx, walletAddr)
+		if err != nil {
+			return TokenResponse{}, Claims{}, fmt.Errorf("failed to resolve roles: %w", err)
+		}
+		grant = resolved.merge(grant)
+	}
+	accessClaims.Scopes = grant.Scopes
+	accessClaims.Roles = grant.Roles
+	if isSession {
+		accessClaims.SessionKey = session.key
+		accessClaims.Scopes = session.limitScopes(grant.Scopes)
+		accessClaims.Roles = nil
+	}
+	if j.enricher != nil {
+		extra, err := j.enricher.Enrich(ctx, walletAddr)
+		if err != nil {
+			return TokenResponse{}, Claims{}, fmt.Errorf("failed to enrich claims: %w", err)
+		}
+		accessClaims.Extra = extra
+	}
+	accessToken := newToken(key, accessClaims)
 
 	// Sign and get the complete encoded token as a string using the secret
-	accessTokenString, err := accessToken.SignedString(j.signingKey)
+	accessTokenString, err := accessToken.SignedString(key.private)
 	if err != nil {
-		return TokenResponse{}, fmt.Errorf("failed to sign token: %w", err)
+		return TokenResponse{}, Claims{}, fmt.Errorf("failed to sign token: %w", err)
 	}
 
 	// Refresh token
-	refreshID := uuid.New().String()
-	refreshExpAt := time.Now().Add(time.Hour * 24 * 7).Unix() // 7 days
-
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		Wallet: walletAddr,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ID:        refreshID,
-			Audience:  jwt.ClaimStrings{"refresh"},
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Unix(refreshExpAt, 0)),
-		},
-	})
+	refreshClaims := j.newClaims(walletAddr, family, TokenTypeRefresh, now, refreshTTL)
+	refreshClaims.Multisig, refreshClaims.Signers = msig.multisig, msig.signers
+	if isSession {
+		refreshClaims.SessionKey = session.key
+		refreshClaims.Scopes = session.scopes
+	}
+	refreshToken := newToken(key, refreshClaims)
 
 	// Sign and get the complete encoded token as a string using the secret
-	refreshTokenString, err := refreshToken.SignedString(j.signingKey)
+	refreshTokenString, err := refreshToken.SignedString(key.private)
 	if err != nil {
-		return TokenResponse{}, fmt.Errorf("failed to sign refresh token: %w", err)
+		return TokenResponse{}, Claims{}, fmt.Errorf("failed to sign refresh token: %w", err)
 	}
 
 	return TokenResponse{
 		Access:    accessTokenString,
 		Refresh:   refreshTokenString,
-		ExpiresIn: 3600, // 1 hour
-	}, nil
+		ExpiresIn: int64(accessTTL / time.Second),
+	}, refreshClaims, nil
+}
+
+// newClaims creates the claims of the new token of the given type.
+func (j *JWT) newClaims(walletAddr, family, typ string, now time.Time, ttl time.Duration) Claims {
+	var audience jwt.ClaimStrings
+	if len(j.validation.Audience) > 0 {
+		audience = append(audience, j.validation.Audience...)
+	}
+
+	return Claims{
+		Wallet: walletAddr,
+		Type:   typ,
+		Family: family,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    j.validation.Issuer,
+			Subject:   walletAddr,
+			Audience:  audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
 }
 
 // VerifyToken verifies the token.
 // This function verifies the token and returns the claims.
+// If token revocation is enabled, revoked tokens and the tokens
+// of the revoked refresh token families are rejected.
 func (j *JWT) VerifyToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	claims, err := j.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.revocation != nil {
+		for _, id := range []string{claims.ID, claims.Family} {
+			if id == "" {
+				continue
+			}
+			revoked, err := j.revocation.IsRevoked(context.Background(), id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check token revocation: %w", err)
+			}
+			if revoked {
+				return nil, ErrTokenRevoked
+			}
 		}
-		return j.signingKey, nil
+	}
+
+	return claims, nil
+}
+
+// VerifyAccessToken verifies the token and checks it's an access token.
+func (j *JWT) VerifyAccessToken(tokenString string) (*Claims, error) {
+	return verifyTokenType(j.VerifyToken, tokenString, TokenTypeAccess)
+}
+
+// VerifyRefreshToken verifies the token and checks it's a refresh token.
+func (j *JWT) VerifyRefreshToken(tokenString string) (*Claims, error) {
+	return verifyTokenType(j.VerifyToken, tokenString, TokenTypeRefresh)
+}
+
+// parseToken parses the token with the current keyring and validates the claims.
+func (j *JWT) parseToken(tokenString string) (*Claims, error) {
+	keyring := j.Keyring()
+	return parseToken(tokenString, j.validation, func(kid string) (Key, error) {
+		return keyring.VerificationKey(kid, time.Now())
 	})
+}
+
+// IntrospectToken verifies the token and, if refresh token rotation is enabled,
+// checks the refresh token is the current one of its family,
+// i.e. it's neither rotated nor revoked with the family.
+func (j *JWT) IntrospectToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := j.VerifyToken(tokenString)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
+		return nil, err
 	}
-
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	if claims.TokenType() != TokenTypeRefresh || j.refresh == nil {
 		return claims, nil
 	}
 
-	return nil, fmt.Errorf("invalid token")
+	// Tokens issued before rotation was enabled can't be refreshed
+	if claims.Family == "" {
+		return nil, ErrRefreshTokenRevoked
+	}
+	if err := j.refresh.Check(ctx, claims.Family, claims.ID); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// RevokeToken revokes the access or refresh token.
+// Revoking the refresh token also revokes all refresh tokens of its family.
+// Without the revocation store the token itself stays valid until it expires,
+// only the family of the refresh token is revoked if rotation is enabled.
+// It returns ErrInvalidToken if the token is invalid or already expired.
+func (j *JWT) RevokeToken(ctx context.Context, tokenString string) error {
+	claims, err := j.parseToken(tokenString)
+	if err != nil {
+		return err
+	}
+
+	if err := j.revoke(ctx, claims); err != nil {
+		return err
+	}
+	if claims.TokenType() == TokenTypeRefresh {
+		return j.revokeFamily(ctx, claims)
+	}
+
+	return nil
+}
+
+// RevokeSession revokes the token with the given claims
+// and all refresh tokens of the same family, i.e. ends the session.
+// Without the revocation store only the refresh token family is revoked.
+func (j *JWT) RevokeSession(ctx context.Context, claims *Claims) error {
+	if err := j.revoke(ctx, claims); err != nil {
+		return err
+	}
+	return j.revokeFamily(ctx, claims)
+}
+
+// revoke revokes the token until it expires, including the leeway,
+// since the token is accepted within the leeway after its expiration time.
+// It does nothing if token revocation is not enabled.
+func (j *JWT) revoke(ctx context.Context, claims *Claims) error {
+	if j.revocation == nil {
+		return nil
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: token has no id or expiration time", ErrInvalidToken)
+	}
+
+	if err := j.revocation.Revoke(ctx, claims.ID, claims.ExpiresAt.Add(j.validation.Leeway)); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// revokeFamily revokes the refresh token family of the token if rotation is enabled.
+// If token revocation is enabled, the access tokens of the family are revoked as well:
+// the family ID is revoked until the last access token issued so far expires.
+func (j *JWT) revokeFamily(ctx context.Context, claims *Claims) error {
+	if j.refresh == nil || claims.Family == "" {
+		return nil
+	}
+	if err := j.refresh.RevokeFamily(ctx, claims.Family); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+
+	if j.revocation != nil {
+		expiresAt := time.Now().Add(j.accessTTL + j.validation.Leeway)
+		if err := j.revocation.Revoke(ctx, claims.Family, expiresAt); err != nil {
+			return fmt.Errorf("failed to revoke token family: %w", err)
+		}
+	}
+	return nil
 }
 
 // RefreshToken refreshes the token.
 // This function refreshes the token and returns the new token.
-func (j *JWT) RefreshToken(tokenString string) (TokenResponse, error) {
+// If refresh token rotation is enabled, the presented token is invalidated,
+// and presenting it again revokes the whole token family.
+// The token is checked to be the current one of its family before the new tokens are issued,
+// so the role resolver, the claims enricher and the multisig check don't run for a reused token.
+func (j *JWT) RefreshToken(ctx context.Context, tokenString string) (TokenResponse, error) {
 	if tokenString == "" {
 		return TokenResponse{}, fmt.Errorf("token is empty")
 	}
 
-	claims, err := j.VerifyToken(tokenString)
+	claims, err := j.VerifyRefreshToken(tokenString)
 	if err != nil {
 		return TokenResponse{}, fmt.Errorf("failed to verify token: %w", err)
 	}
+	if j.refresh != nil {
+		// Tokens issued before rotation was enabled can't be tracked
+		if claims.Family == "" {
+			return TokenResponse{}, ErrRefreshTokenRevoked
+		}
+		if err := j.refresh.Check(ctx, claims.Family, claims.ID); err != nil {
+			return TokenResponse{}, j.refreshTokenError(ctx, claims, err)
+		}
+	}
+
+	if claims.Multisig != "" {
+		if err := j.checkMultisigSigners(ctx, claims); err != nil {
+			return TokenResponse{}, err
+		}
+		ctx = withMultisigSigners(ctx, claims.Multisig, claims.Signers)
+	}
+	// The refresh token of the session key expires with the delegation
+	if claims.SessionKey != "" {
+		ctx = withSessionDelegation(ctx, sessionDelegation{
+			key:       claims.SessionKey,
+			scopes:    claims.Scopes,
+			expiresAt: claims.ExpiresAt.Time,
+		})
+	}
 
-	if claims.Audience[0] != "refresh" {
-		return TokenResponse{}, fmt.Errorf("the token is not a refresh token")
+	if j.refresh == nil {
+		tokens, _, err := j.issueTokens(ctx, claims.Wallet, "")
+		return tokens, err
+	}
+
+	tokens, refreshClaims, err := j.issueTokens(ctx, claims.Wallet, claims.Family)
+	if err != nil {
+		return TokenResponse{}, err
 	}
 
-	return j.IssueTokens(claims.Wallet)
+	// The concurrent refresh with the same token may have rotated it after the check
+	err = j.refresh.Rotate(ctx, claims.Family, claims.ID, refreshClaims.ID, refreshClaims.ExpiresAt.Time)
+	if err != nil {
+		return TokenResponse{}, j.refreshTokenError(ctx, claims, err)
+	}
+
+	return tokens, nil
+}
+
+// refreshTokenError handles the error of the refresh token store.
+// On the refresh token reuse it revokes the token family and emits the security event.
+func (j *JWT) refreshTokenError(ctx context.Context, claims *Claims, err error) error {
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		return err
+	}
+
+	if err := j.revokeFamily(ctx, claims); err != nil {
+		return err
+	}
+	if j.onEvent != nil {
+		j.onEvent(ctx, SecurityEvent{
+			Type:    SecurityEventRefreshTokenReuse,
+			Wallet:  claims.Wallet,
+			Family:  claims.Family,
+			TokenID: claims.ID,
+			Time:    time.Now(),
+		})
+	}
+	return ErrRefreshTokenReused
+}
+
+// checkMultisigSigners checks the signers of the multisig vault token
+// are still enough voting members of the multisig.
+func (j *JWT) checkMultisigSigners(ctx context.Context, claims *Claims) error {
+	if j.multisigs == nil {
+		return fmt.Errorf("%w: multisig tokens can't be refreshed", ErrRefreshTokenRevoked)
+	}
+
+	multisig, err := FetchMultisig(ctx, j.multisigs, claims.Multisig)
+	if errors.Is(err, ErrInvalidMultisig) {
+		return fmt.Errorf("%w: %s", ErrRefreshTokenRevoked, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch multisig: %w", err)
+	}
+	if err := multisig.CheckSigners(claims.Signers); err != nil {
+		return fmt.Errorf("%w: %s", ErrRefreshTokenRevoked, err)
+	}
+
+	return nil
+}
+
+// parseToken parses the token, verifies it with the key found by the "kid" header
+// and validates the claims.
+// The errors of the invalid tokens wrap ErrInvalidToken, while the errors
+// of the key lookup, e.g. the key set can't be fetched, are returned as is.
+func parseToken(tokenString string, v TokenValidation, lookup func(kid string) (Key, error)) (*Claims, error) {
+	opts := []jwt.ParserOption{jwt.WithLeeway(v.Leeway), jwt.WithIssuedAt()}
+	if v.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.Issuer))
+	}
+
+	var lookupErr error
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := lookup(kid)
+		if err != nil {
+			lookupErr = err
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.public, nil
+	}, opts...)
+	if lookupErr != nil && !errors.Is(lookupErr, ErrUnknownKey) {
+		return nil, fmt.Errorf("failed to get verification key: %w", lookupErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if len(v.Audience) > 0 && !hasAudience(claims.Audience, v.Audience...) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	if claims.Subject != "" && claims.Subject != claims.Wallet {
+		return nil, fmt.Errorf("%w: subject doesn't match the wallet", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// isTokenRejected reports whether the verification or refresh error means the token
+// is invalid, expired or revoked, or the multisig signers no longer meet the threshold,
+// unlike the errors of the stores, of the RPC or of the key set fetch.
+func isTokenRejected(err error) bool {
+	for _, target := range []error{
+		ErrInvalidToken,
+		ErrTokenRevoked,
+		ErrUnexpectedTokenType,
+		ErrRefreshTokenReused,
+		ErrRefreshTokenRevoked,
+		ErrMultisigThreshold,
+		ErrNotMultisigMember,
+		ErrDelegationExpired,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyTokenType verifies the token with the given function
+// and checks the token type.
+func verifyTokenType(verify func(string) (*Claims, error), tokenString, typ string) (*Claims, error) {
+	claims, err := verify(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType() != typ {
+		return nil, fmt.Errorf("%w: expected %s token", ErrUnexpectedTokenType, typ)
+	}
+	return claims, nil
+}
+
+// hasAudience reports whether the audience list contains any of the values.
+func hasAudience(list jwt.ClaimStrings, values ...string) bool {
+	for _, a := range list {
+		for _, v := range values {
+			if a == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newToken creates a new token signed with the key.
+func newToken(key Key, claims Claims) *jwt.Token {
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token
 }
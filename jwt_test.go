@@ -0,0 +1,298 @@
+package solauth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsymmetricJWT(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for alg, key := range map[string]crypto.Signer{
+		solauth.AlgEdDSA: edKey,
+		solauth.AlgES256: ecKey,
+		solauth.AlgRS256: rsaKey,
+	} {
+		t.Run(alg, func(t *testing.T) {
+			privDER, err := x509.MarshalPKCS8PrivateKey(key)
+			require.NoError(t, err)
+			pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+			require.NoError(t, err)
+
+			signer, err := solauth.NewJWTFromPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))
+			require.NoError(t, err)
+			require.Equal(t, alg, signer.Keyring().Keys()[0].Algorithm())
+
+			verifier, err := solauth.NewJWTFromPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+			require.NoError(t, err)
+			require.False(t, verifier.Keyring().Keys()[0].CanSign())
+
+			tokens, err := signer.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+			require.NoError(t, err)
+
+			claims, err := verifier.VerifyToken(tokens.Access)
+			require.NoError(t, err)
+			require.Equal(t, wallet.PublicKey.ToBase58(), claims.Wallet)
+
+			_, err = verifier.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+			require.ErrorIs(t, err, solauth.ErrVerifyOnly)
+
+			// Token signed with HMAC using the public key as a secret must be rejected
+			forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(pubDER)
+			require.NoError(t, err)
+			_, err = verifier.VerifyToken(forged)
+			require.Error(t, err)
+		})
+	}
+
+	t.Run("raw ed25519 seed", func(t *testing.T) {
+		key, err := solauth.ParseKey(edKey.Seed())
+		require.NoError(t, err)
+		require.Equal(t, solauth.AlgEdDSA, key.Algorithm())
+		require.True(t, key.CanSign())
+	})
+
+	t.Run("unsupported keys", func(t *testing.T) {
+		p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		require.NoError(t, err)
+		_, err = solauth.NewPrivateKey(p384)
+		require.Error(t, err)
+
+		rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+		require.NoError(t, err)
+		_, err = solauth.NewPrivateKey(rsa1024)
+		require.Error(t, err)
+	})
+}
+
+func TestKeyring(t *testing.T) {
+	now := time.Now()
+
+	oldKey := solauth.NewHMACKey([]byte("old secret"))
+	oldKey.ID = "old"
+	newKey := solauth.NewHMACKey([]byte("new secret"))
+	newKey.ID = "new"
+	newKey.ActivatesAt = now.Add(time.Hour)
+
+	keyring, err := solauth.NewKeyring(oldKey, newKey)
+	require.NoError(t, err)
+	j := solauth.NewJWTWithKeyring(keyring)
+
+	tokens, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+	requireKeyID(t, tokens.Access, "old")
+
+	// The new key is activated, the old one is still valid for verification
+	newKey.ActivatesAt = now.Add(-time.Minute)
+	keyring, err = solauth.NewKeyring(oldKey, newKey)
+	require.NoError(t, err)
+	j.SetKeyring(keyring)
+
+	_, err = j.VerifyToken(tokens.Access)
+	require.NoError(t, err)
+
+	rotated, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+	requireKeyID(t, rotated.Access, "new")
+
+	// The old key is retired
+	oldKey.ActivatesAt = now.Add(-time.Hour)
+	oldKey.RetiresAt = now.Add(-time.Second)
+	keyring, err = solauth.NewKeyring(oldKey, newKey)
+	require.NoError(t, err)
+	j.SetKeyring(keyring)
+
+	_, err = j.VerifyToken(tokens.Access)
+	require.Error(t, err)
+	_, err = j.VerifyToken(rotated.Access)
+	require.NoError(t, err)
+
+	t.Run("duplicate key id", func(t *testing.T) {
+		_, err := solauth.NewKeyring(oldKey, oldKey)
+		require.Error(t, err)
+	})
+}
+
+func TestLoadKeyring(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "legacy.pem"), pem.EncodeToMemory(&pem.Block{
+		Type:    solauth.PEMTypeHMACKey,
+		Headers: map[string]string{solauth.PEMHeaderRetiresAt: time.Now().Add(time.Hour).Format(time.RFC3339)},
+		Bytes:   authSigningKey,
+	}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ed25519.pem"), pem.EncodeToMemory(&pem.Block{
+		Type: "PRIVATE KEY",
+		Headers: map[string]string{
+			solauth.PEMHeaderKeyID:       "2023-03",
+			solauth.PEMHeaderActivatesAt: time.Now().Add(-time.Minute).Format(time.RFC3339),
+		},
+		Bytes: der,
+	}), 0o600))
+
+	keyring, err := solauth.LoadKeyring(dir)
+	require.NoError(t, err)
+	require.Len(t, keyring.Keys(), 2)
+
+	j := solauth.NewJWTWithKeyring(keyring)
+
+	// Tokens issued before the rotation have no "kid" header
+	legacy, err := solauth.NewJWT(authSigningKey).IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+	_, err = j.VerifyToken(legacy.Access)
+	require.NoError(t, err)
+
+	tokens, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+	requireKeyID(t, tokens.Access, "2023-03")
+	_, err = j.VerifyToken(tokens.Access)
+	require.NoError(t, err)
+}
+
+func requireKeyID(t *testing.T, tokenString, kid string) {
+	t.Helper()
+
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &solauth.Claims{})
+	require.NoError(t, err)
+	require.Equal(t, kid, token.Header["kid"])
+}
+
+func TestJWTOptions(t *testing.T) {
+	walletAddr := wallet.PublicKey.ToBase58()
+	j := solauth.NewJWT(authSigningKey,
+		solauth.WithAccessTTL(time.Minute*15),
+		solauth.WithRefreshTTL(time.Hour*24),
+		solauth.WithIssuer("https://auth.example.com"),
+		solauth.WithAudience("api.example.com", "app.example.com"),
+	)
+
+	tokens, err := j.IssueTokens(context.Background(), walletAddr)
+	require.NoError(t, err)
+	require.EqualValues(t, 900, tokens.ExpiresIn)
+
+	claims, err := j.VerifyToken(tokens.Access)
+	require.NoError(t, err)
+	require.Equal(t, "https://auth.example.com", claims.Issuer)
+	require.Equal(t, walletAddr, claims.Subject)
+	require.Equal(t, jwt.ClaimStrings{"api.example.com", "app.example.com"}, claims.Audience)
+	require.Equal(t, solauth.TokenTypeAccess, claims.Type)
+	require.WithinDuration(t, time.Now().Add(time.Minute*15), claims.ExpiresAt.Time, time.Second*2)
+
+	refreshClaims, err := j.VerifyToken(tokens.Refresh)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Hour*24), refreshClaims.ExpiresAt.Time, time.Second*2)
+
+	_, err = j.RefreshToken(context.Background(), tokens.Refresh)
+	require.NoError(t, err)
+	_, err = j.RefreshToken(context.Background(), tokens.Access)
+	require.Error(t, err)
+
+	t.Run("issuer mismatch", func(t *testing.T) {
+		other := solauth.NewJWT(authSigningKey, solauth.WithIssuer("https://other.example.com"))
+		_, err := other.VerifyToken(tokens.Access)
+		require.Error(t, err)
+	})
+
+	t.Run("audience mismatch", func(t *testing.T) {
+		other := solauth.NewJWT(authSigningKey, solauth.WithAudience("admin.example.com"))
+		_, err := other.VerifyToken(tokens.Access)
+		require.Error(t, err)
+
+		anyOf := solauth.NewJWT(authSigningKey, solauth.WithAudience("admin.example.com", "app.example.com"))
+		_, err = anyOf.VerifyToken(tokens.Access)
+		require.NoError(t, err)
+	})
+
+	t.Run("subject mismatch", func(t *testing.T) {
+		forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, solauth.Claims{
+			Wallet:           "another-wallet",
+			RegisteredClaims: claims.RegisteredClaims,
+		}).SignedString(authSigningKey)
+		require.NoError(t, err)
+		_, err = j.VerifyToken(forged)
+		require.Error(t, err)
+	})
+
+	t.Run("leeway", func(t *testing.T) {
+		expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, solauth.Claims{
+			Wallet: walletAddr,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   walletAddr,
+				Audience:  jwt.ClaimStrings{"access"},
+				IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Second * 10)),
+			},
+		}).SignedString(authSigningKey)
+		require.NoError(t, err)
+
+		_, err = solauth.NewJWT(authSigningKey).VerifyToken(expired)
+		require.Error(t, err)
+		_, err = solauth.NewJWT(authSigningKey, solauth.WithLeeway(time.Minute)).VerifyToken(expired)
+		require.NoError(t, err)
+	})
+}
+
+func TestVerifyTokenType(t *testing.T) {
+	walletAddr := wallet.PublicKey.ToBase58()
+	j := solauth.NewJWT(authSigningKey)
+
+	tokens, err := j.IssueTokens(context.Background(), walletAddr)
+	require.NoError(t, err)
+
+	claims, err := j.VerifyAccessToken(tokens.Access)
+	require.NoError(t, err)
+	require.Equal(t, solauth.TokenTypeAccess, claims.Type)
+	_, err = j.VerifyAccessToken(tokens.Refresh)
+	require.ErrorIs(t, err, solauth.ErrUnexpectedTokenType)
+
+	claims, err = j.VerifyRefreshToken(tokens.Refresh)
+	require.NoError(t, err)
+	require.Equal(t, solauth.TokenTypeRefresh, claims.Type)
+	_, err = j.VerifyRefreshToken(tokens.Access)
+	require.ErrorIs(t, err, solauth.ErrUnexpectedTokenType)
+
+	_, err = j.RefreshToken(context.Background(), tokens.Access)
+	require.ErrorIs(t, err, solauth.ErrUnexpectedTokenType)
+
+	t.Run("legacy token", func(t *testing.T) {
+		// Tokens issued before the "typ" claim have the type in the "aud" claim
+		legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, solauth.Claims{
+			Wallet: walletAddr,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{"refresh"},
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}).SignedString(authSigningKey)
+		require.NoError(t, err)
+
+		_, err = j.VerifyRefreshToken(legacy)
+		require.NoError(t, err)
+		_, err = j.VerifyAccessToken(legacy)
+		require.ErrorIs(t, err, solauth.ErrUnexpectedTokenType)
+	})
+}
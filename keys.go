@@ -0,0 +1,198 @@
+package solauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgES256 = "ES256"
+	AlgRS256 = "RS256"
+)
+
+// minRSAKeySize is the minimal size of the RSA key in bits.
+const minRSAKeySize = 2048
+
+// Key is the key to sign and verify tokens.
+// It's either a shared HMAC secret, an asymmetric private key
+// or a public key only, which can be used for verification only.
+type Key struct {
+	// ID is the key ID set to the "kid" header of the signed tokens.
+	ID string
+	// ActivatesAt is the time the key can be used to sign tokens since.
+	// Zero value means the key is active since its creation.
+	ActivatesAt time.Time
+	// RetiresAt is the time the key can't be used to sign and verify tokens after.
+	// Zero value means the key never retires.
+	RetiresAt time.Time
+
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// NewHMACKey creates a new HS256 key from the shared secret.
+func NewHMACKey(secret []byte) Key {
+	return Key{
+		method:  jwt.SigningMethodHS256,
+		private: secret,
+		public:  secret,
+	}
+}
+
+// NewPrivateKey creates a new key to sign and verify tokens.
+// Supported keys: ed25519.PrivateKey (EdDSA), *ecdsa.PrivateKey with P-256 curve (ES256)
+// and *rsa.PrivateKey of at least 2048 bits (RS256).
+func NewPrivateKey(key crypto.PrivateKey) (Key, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return Key{method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	case *ed25519.PrivateKey:
+		return NewPrivateKey(*k)
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return Key{}, fmt.Errorf("unsupported ecdsa curve: %s, only P-256 is supported", k.Curve.Params().Name)
+		}
+		return Key{method: jwt.SigningMethodES256, private: k, public: &k.PublicKey}, nil
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeySize {
+			return Key{}, fmt.Errorf("rsa key is too short: %d bits, at least %d bits required", k.N.BitLen(), minRSAKeySize)
+		}
+		return Key{method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	}
+	return Key{}, fmt.Errorf("unsupported private key type: %T", key)
+}
+
+// NewPublicKey creates a new key to verify tokens only.
+// Supported keys: ed25519.PublicKey (EdDSA), *ecdsa.PublicKey with P-256 curve (ES256)
+// and *rsa.PublicKey of at least 2048 bits (RS256).
+func NewPublicKey(key crypto.PublicKey) (Key, error) {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return Key{method: jwt.SigningMethodEdDSA, public: k}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return Key{}, fmt.Errorf("unsupported ecdsa curve: %s, only P-256 is supported", k.Curve.Params().Name)
+		}
+		return Key{method: jwt.SigningMethodES256, public: k}, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSAKeySize {
+			return Key{}, fmt.Errorf("rsa key is too short: %d bits, at least %d bits required", k.N.BitLen(), minRSAKeySize)
+		}
+		return Key{method: jwt.SigningMethodRS256, public: k}, nil
+	}
+	return Key{}, fmt.Errorf("unsupported public key type: %T", key)
+}
+
+// Algorithm returns the JWT signing algorithm of the key.
+func (k Key) Algorithm() string {
+	if k.method == nil {
+		return ""
+	}
+	return k.method.Alg()
+}
+
+// Active reports whether the key can be used to sign tokens at the given time.
+func (k Key) Active(now time.Time) bool {
+	return !now.Before(k.ActivatesAt) && !k.Retired(now)
+}
+
+// Retired reports whether the key is retired at the given time.
+func (k Key) Retired(now time.Time) bool {
+	return !k.RetiresAt.IsZero() && !now.Before(k.RetiresAt)
+}
+
+// CanSign reports whether the key can be used to sign tokens.
+func (k Key) CanSign() bool {
+	return k.private != nil
+}
+
+// Symmetric reports whether the key is a shared secret.
+func (k Key) Symmetric() bool {
+	return k.Algorithm() == AlgHS256
+}
+
+// PublicKey returns the public key to verify tokens,
+// or nil for the symmetric keys.
+func (k Key) PublicKey() crypto.PublicKey {
+	if k.Symmetric() {
+		return nil
+	}
+	return k.public
+}
+
+// ParsePrivateKey parses the private key.
+// It accepts PEM or DER encoded PKCS #8, PKCS #1 (RSA) and SEC 1 (EC) keys,
+// and raw ed25519 keys: 32 bytes seed or 64 bytes private key.
+func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	} else {
+		switch len(data) {
+		case ed25519.SeedSize:
+			return ed25519.NewKeyFromSeed(data), nil
+		case ed25519.PrivateKeySize:
+			return ed25519.PrivateKey(data), nil
+		}
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(data); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("failed to parse private key: unsupported format")
+}
+
+// ParsePublicKey parses the public key.
+// It accepts PEM or DER encoded PKIX and PKCS #1 (RSA) keys, X.509 certificates,
+// and raw 32 bytes ed25519 public keys.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	} else if len(data) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(data), nil
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(data); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(data); err == nil {
+		return key, nil
+	}
+	if cert, err := x509.ParseCertificate(data); err == nil {
+		return cert.PublicKey, nil
+	}
+
+	return nil, fmt.Errorf("failed to parse public key: unsupported format")
+}
+
+// ParseKey parses the private or public key, see ParsePrivateKey and ParsePublicKey.
+// The key parsed from the public key can be used for verification only.
+// Raw 32 bytes are treated as ed25519 seed, use ParsePublicKey for raw public keys.
+func ParseKey(data []byte) (Key, error) {
+	if priv, err := ParsePrivateKey(data); err == nil {
+		return NewPrivateKey(priv)
+	}
+	if pub, err := ParsePublicKey(data); err == nil {
+		return NewPublicKey(pub)
+	}
+	return Key{}, fmt.Errorf("failed to parse key: unsupported format")
+}
@@ -0,0 +1,595 @@
+package solauth
+
+import (
+	"container/heap"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the cross-device login.
+const (
+	DefaultLoginSessionTTL  = time.Minute * 5
+	DefaultLongPollTimeout  = time.Second * 30
+	DefaultMaxLoginSessions = 10000
+)
+
+// LoginSessionSecretHeader is the header with the secret of the login session.
+const LoginSessionSecretHeader = "X-Login-Session-Secret"
+
+// sseKeepAliveInterval is the interval of the comments sent to keep the event stream open.
+const sseKeepAliveInterval = time.Second * 15
+
+// LoginSession is the cross-device login session, e.g. the desktop site
+// shows the QR code with the session ID and the mobile wallet signs in for it.
+type LoginSession struct {
+	// ID is the public ID of the session encoded in the QR code.
+	ID string
+	// Secret is known to the desktop only, it's required to receive the tokens.
+	Secret string
+	// ExpiresAt is the time the session expires at.
+	ExpiresAt time.Time
+	// Wallet is the address of the wallet which claimed the session.
+	Wallet string
+	// Tokens is the tokens issued for the wallet, nil until the session is completed.
+	Tokens *TokenResponse
+}
+
+// Claimed reports whether the wallet signed in for the session,
+// its tokens may be not issued yet.
+func (s LoginSession) Claimed() bool {
+	return s.Wallet != ""
+}
+
+// Completed reports whether the tokens are issued for the session.
+func (s LoginSession) Completed() bool {
+	return s.Tokens != nil
+}
+
+// LoginSessionStore keeps the login sessions until the tokens are delivered.
+type LoginSessionStore interface {
+	// Create saves the new session.
+	// It returns ErrTooManyLoginSessions if no more sessions can be saved.
+	Create(ctx context.Context, s LoginSession) error
+	// Get returns the session or ErrLoginSessionNotFound if it's expired or delivered.
+	Get(ctx context.Context, id string) (LoginSession, error)
+	// Claim assigns the session to the wallet which signed in, before the tokens are issued.
+	// It must be atomic: only one of concurrent claims succeeds, the others
+	// get ErrLoginSessionCompleted.
+	Claim(ctx context.Context, id, walletAddr string) error
+	// Complete saves the tokens issued for the wallet which claimed the session.
+	// It returns ErrLoginSessionCompleted if the session is already completed
+	// or claimed by another wallet.
+	Complete(ctx context.Context, id, walletAddr string, tokens TokenResponse) error
+	// Wait blocks until the session is completed, then returns and removes it,
+	// so the tokens are delivered once.
+	// It returns ErrLoginSessionNotFound if the session expires first,
+	// or the context error if the context is done.
+	Wait(ctx context.Context, id string) (LoginSession, error)
+}
+
+// MemoryLoginSessionStore is the in-memory implementation of LoginSessionStore.
+// It's suitable for a single instance deployment only.
+type MemoryLoginSessionStore struct {
+	mu     sync.Mutex
+	limit  int
+	items  map[string]*loginSessionEntry
+	expiry loginSessionQueue
+}
+
+// loginSessionEntry is the stored session with the channel closed on completion.
+type loginSessionEntry struct {
+	session LoginSession
+	done    chan struct{}
+}
+
+// NewMemoryLoginSessionStore creates a new in-memory login session store
+// which keeps up to limit active sessions.
+// If limit is not positive, DefaultMaxLoginSessions is used.
+func NewMemoryLoginSessionStore(limit int) *MemoryLoginSessionStore {
+	if limit <= 0 {
+		limit = DefaultMaxLoginSessions
+	}
+	return &MemoryLoginSessionStore{
+		limit: limit,
+		items: make(map[string]*loginSessionEntry),
+	}
+}
+
+// Create saves the session and drops the expired ones.
+// It returns ErrTooManyLoginSessions if the store is full.
+func (s *MemoryLoginSessionStore) Create(_ context.Context, session LoginSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only the expired sessions are popped from the queue
+	now := time.Now()
+	for len(s.expiry) > 0 && !now.Before(s.expiry[0].session.ExpiresAt) {
+		item := heap.Pop(&s.expiry).(*loginSessionEntry)
+		if s.items[item.session.ID] == item {
+			delete(s.items, item.session.ID)
+		}
+	}
+
+	if len(s.items) >= s.limit {
+		return ErrTooManyLoginSessions
+	}
+
+	item := &loginSessionEntry{session: session, done: make(chan struct{})}
+	s.items[session.ID] = item
+	heap.Push(&s.expiry, item)
+
+	return nil
+}
+
+// Get returns the session with the given ID.
+func (s *MemoryLoginSessionStore) Get(_ context.Context, id string) (LoginSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.get(id)
+	if err != nil {
+		return LoginSession{}, err
+	}
+	return item.session, nil
+}
+
+// Claim assigns the session to the wallet.
+func (s *MemoryLoginSessionStore) Claim(_ context.Context, id, walletAddr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if item.session.Claimed() {
+		return ErrLoginSessionCompleted
+	}
+
+	item.session.Wallet = walletAddr
+	return nil
+}
+
+// Complete saves the tokens and wakes up the waiters.
+func (s *MemoryLoginSessionStore) Complete(_ context.Context, id, walletAddr string, tokens TokenResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if item.session.Completed() || item.session.Wallet != walletAddr {
+		return ErrLoginSessionCompleted
+	}
+
+	item.session.Tokens = &tokens
+	close(item.done)
+
+	return nil
+}
+
+// Wait blocks until the session is completed, expires or the context is done.
+func (s *MemoryLoginSessionStore) Wait(ctx context.Context, id string) (LoginSession, error) {
+	s.mu.Lock()
+	item, err := s.get(id)
+	s.mu.Unlock()
+	if err != nil {
+		return LoginSession{}, err
+	}
+
+	timer := time.NewTimer(time.Until(item.session.ExpiresAt))
+	defer timer.Stop()
+
+	select {
+	case <-item.done:
+	case <-timer.C:
+		return LoginSession{}, ErrLoginSessionNotFound
+	case <-ctx.Done():
+		return LoginSession{}, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Only the first waiter gets the tokens
+	if s.items[id] != item {
+		return LoginSession{}, ErrLoginSessionNotFound
+	}
+	delete(s.items, id)
+
+	return item.session, nil
+}
+
+// get returns the active session entry. The caller must hold the lock.
+func (s *MemoryLoginSessionStore) get(id string) (*loginSessionEntry, error) {
+	item, ok := s.items[id]
+	if !ok {
+		return nil, ErrLoginSessionNotFound
+	}
+	if !time.Now().Before(item.session.ExpiresAt) {
+		delete(s.items, id)
+		return nil, ErrLoginSessionNotFound
+	}
+	return item, nil
+}
+
+// loginSessionQueue is the min-heap of the sessions ordered by the expiration time.
+type loginSessionQueue []*loginSessionEntry
+
+func (q loginSessionQueue) Len() int { return len(q) }
+
+func (q loginSessionQueue) Less(i, j int) bool {
+	return q[i].session.ExpiresAt.Before(q[j].session.ExpiresAt)
+}
+
+func (q loginSessionQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *loginSessionQueue) Push(x interface{}) {
+	*q = append(*q, x.(*loginSessionEntry))
+}
+
+func (q *loginSessionQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return item
+}
+
+// CreateLoginSession is the handler to start the cross-device login on the desktop.
+// It returns the session ID and secret, and the URL with the "session_id" query parameter
+// added to loginURL to show as the QR code, e.g.:
+//
+//	{"session_id": "...", "secret": "...", "url": "https://example.com/login?session_id=...", "expires_at": 1683000000}
+//
+// The mobile wallet opens the URL, gets the challenge with LoginSessionChallenge
+// and signs in with VerifyLoginSession. The desktop receives the tokens with LoginSessionTokens.
+// If ttl is not positive, DefaultLoginSessionTTL is used.
+func CreateLoginSession(store LoginSessionStore, loginURL string, ttl time.Duration) http.HandlerFunc {
+	if ttl <= 0 {
+		ttl = DefaultLoginSessionTTL
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := url.Parse(loginURL)
+		if err != nil {
+			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"code":  http.StatusInternalServerError,
+				"error": fmt.Sprintf("invalid login url: %s", err),
+			})
+			return
+		}
+
+		id, err := newNonce()
+		if err != nil {
+			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"code":  http.StatusInternalServerError,
+				"error": err.Error(),
+			})
+			return
+		}
+		secret, err := newNonce()
+		if err != nil {
+			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"code":  http.StatusInternalServerError,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		session := LoginSession{
+			ID:        id,
+			Secret:    secret,
+			ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+		}
+		if err := store.Create(r.Context(), session); err != nil {
+			loginSessionError(w, err)
+			return
+		}
+
+		q := u.Query()
+		q.Set("session_id", id)
+		u.RawQuery = q.Encode()
+
+		defaultResponse(w, http.StatusOK, map[string]interface{}{
+			"session_id": id,
+			"secret":     secret,
+			"url":        u.String(),
+			"expires_at": session.ExpiresAt.Unix(),
+		})
+	}
+}
+
+// LoginSessionChallengePayload is the payload for the challenge of the login session.
+type LoginSessionChallengePayload struct {
+	// SessionID is the ID of the login session from the QR code.
+	SessionID string `json:"session_id"`
+	// PublicKey is the public key of the wallet.
+	PublicKey string `json:"public_key"`
+}
+
+// LoginSessionChallenge is the handler for the mobile wallet to get the challenge
+// of the login session. It responds like RequestAuth.
+// The challenge is bound to the session: its request ID is the session ID.
+func LoginSessionChallenge(store LoginSessionStore, challenger interface {
+	IssueChallenge(ctx context.Context, publicKey string) (Challenge, error)
+}, opts ...HandlerOption,
+) http.HandlerFunc {
+	o := newHandlerOptions(opts...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse JSON request
+		var payload LoginSessionChallengePayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Check the session is pending
+		if !checkLoginSession(w, r, store, payload.SessionID) {
+			return
+		}
+
+		// The session ID is the request ID of the challenge, so the wallet shows it
+		// and the signature can't be used for another session
+		r = r.WithContext(withChallengeRequestID(r.Context(), payload.SessionID))
+		o.issueChallenge(w, r, challenger, payload.PublicKey)
+	}
+}
+
+// VerifyLoginSession is the handler for the mobile wallet to sign in for the login session.
+// The payload is VerifySignedMessagePayload with the "session_id" field.
+// The tokens are issued like VerifySignedMessage does, but they are saved to the session
+// for the desktop instead of being returned, the handler responds with 204.
+// Only the challenge issued by LoginSessionChallenge for the same session is accepted.
+// Each session can be completed once: the session is claimed by the wallet
+// before the tokens are issued, so concurrent sign-ins don't issue tokens nobody receives.
+// If the tokens can't be issued, the claimed session expires and the desktop starts a new one.
+func VerifyLoginSession(store LoginSessionStore, challenger interface {
+	VerifyChallenge(ctx context.Context, publicKey, message string) error
+}, jwt interface {
+	IssueTokens(ctx context.Context, walletAddr string) (TokenResponse, error)
+}, opts ...HandlerOption,
+) http.HandlerFunc {
+	o := newHandlerOptions(opts...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse JSON request
+		var raw json.RawMessage
+		var session struct {
+			SessionID string `json:"session_id"`
+		}
+		var payload VerifySignedMessagePayload
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+		if err := json.Unmarshal(raw, &session); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Check the session is pending
+		if !checkLoginSession(w, r, store, session.SessionID) {
+			return
+		}
+
+		// Verify the signature of the challenge issued for the session and check the access
+		r = r.WithContext(withChallengeRequestID(r.Context(), session.SessionID))
+		ctx, walletAddr, ok := o.verifySignedMessage(w, r, challenger, payload)
+		if !ok {
+			return
+		}
+
+		// Claim the session, so the tokens are issued for one wallet only
+		if err := store.Claim(r.Context(), session.SessionID, walletAddr); err != nil {
+			loginSessionError(w, err)
+			return
+		}
+
+		// Issue tokens
+		tokens, err := jwt.IssueTokens(ctx, walletAddr)
+		if err != nil {
+			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"code":  http.StatusInternalServerError,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Complete the session
+		if err := store.Complete(r.Context(), session.SessionID, walletAddr, tokens); err != nil {
+			loginSessionError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// checkLoginSession checks the login session exists and is not claimed yet.
+// It writes the error response and returns false otherwise.
+func checkLoginSession(w http.ResponseWriter, r *http.Request, store LoginSessionStore, id string) bool {
+	if id == "" {
+		defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"code":  http.StatusBadRequest,
+			"error": "session_id is required",
+		})
+		return false
+	}
+
+	session, err := store.Get(r.Context(), id)
+	if err == nil && session.Claimed() {
+		err = ErrLoginSessionCompleted
+	}
+	if err != nil {
+		loginSessionError(w, err)
+		return false
+	}
+
+	return true
+}
+
+// loginSessionError writes the response for the login session error:
+// 404 if the session is not found, 409 if it's already completed,
+// 503 if there are too many sessions, 500 otherwise.
+func loginSessionError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrLoginSessionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrLoginSessionCompleted):
+		status = http.StatusConflict
+	case errors.Is(err, ErrTooManyLoginSessions):
+		status = http.StatusServiceUnavailable
+	}
+	defaultResponse(w, status, map[string]interface{}{
+		"code":  status,
+		"error": err.Error(),
+	})
+}
+
+// LoginSessionTokens is the handler for the desktop to receive the tokens of the login session.
+// The session is identified with the "session_id" query parameter
+// and the secret in the LoginSessionSecretHeader header.
+//
+// If the request accepts "text/event-stream", the tokens are sent as Server-Sent Events:
+// the "tokens" event with TokenResponse once the session is completed,
+// or the "expired" event with the JSON error envelope if the session expires.
+// Since EventSource can't set headers, the secret can be sent in the "secret" query
+// parameter of the event stream request, keep it out of the access logs then.
+//
+// Otherwise the request is long-polled: it responds with TokenResponse once the session
+// is completed, with 202 and {"status": "pending"} after pollTimeout to poll again,
+// or with 404 if the session expires.
+// If pollTimeout is not positive, DefaultLongPollTimeout is used.
+func LoginSessionTokens(store LoginSessionStore, pollTimeout time.Duration) http.HandlerFunc {
+	if pollTimeout <= 0 {
+		pollTimeout = DefaultLongPollTimeout
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("session_id")
+		stream := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+		secret := r.Header.Get(LoginSessionSecretHeader)
+		if secret == "" && stream {
+			secret = r.URL.Query().Get("secret")
+		}
+		if secret == "" {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": LoginSessionSecretHeader + " header is required",
+			})
+			return
+		}
+
+		session, err := store.Get(r.Context(), id)
+		if err == nil && subtle.ConstantTimeCompare([]byte(session.Secret), []byte(secret)) != 1 {
+			err = ErrLoginSessionNotFound
+		}
+		if err != nil {
+			loginSessionError(w, err)
+			return
+		}
+
+		if stream {
+			streamLoginSession(w, r, store, id)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), pollTimeout)
+		defer cancel()
+
+		session, err = store.Wait(ctx, id)
+		switch {
+		case err == nil:
+			defaultResponse(w, http.StatusOK, session.Tokens)
+		case r.Context().Err() != nil:
+			// the client is gone
+		case errors.Is(err, context.DeadlineExceeded):
+			defaultResponse(w, http.StatusAccepted, map[string]interface{}{
+				"status": "pending",
+			})
+		default:
+			loginSessionError(w, err)
+		}
+	}
+}
+
+// streamLoginSession sends the tokens of the login session as Server-Sent Events.
+func streamLoginSession(w http.ResponseWriter, r *http.Request, store LoginSessionStore, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"code":  http.StatusInternalServerError,
+			"error": "streaming is not supported",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	event := func(name string, data interface{}) {
+		payload, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload)
+		flusher.Flush()
+	}
+
+	for {
+		ctx, cancel := context.WithTimeout(r.Context(), sseKeepAliveInterval)
+		session, err := store.Wait(ctx, id)
+		cancel()
+
+		switch {
+		case err == nil:
+			event("tokens", session.Tokens)
+			return
+		case r.Context().Err() != nil:
+			// the client is gone
+			return
+		case errors.Is(err, context.DeadlineExceeded):
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		default:
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrLoginSessionNotFound) {
+				status = http.StatusNotFound
+			}
+			event("expired", map[string]interface{}{
+				"code":  status,
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package solauth_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/portto/solana-go-sdk/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryLoginSessionStore(t *testing.T) {
+	ctx := context.Background()
+	store := solauth.NewMemoryLoginSessionStore(0)
+
+	require.NoError(t, store.Create(ctx, solauth.LoginSession{ID: "expired", ExpiresAt: time.Now().Add(-time.Second)}))
+	_, err := store.Get(ctx, "expired")
+	require.ErrorIs(t, err, solauth.ErrLoginSessionNotFound)
+
+	require.NoError(t, store.Create(ctx, solauth.LoginSession{ID: "short", ExpiresAt: time.Now().Add(time.Millisecond * 50)}))
+	_, err = store.Wait(ctx, "short")
+	require.ErrorIs(t, err, solauth.ErrLoginSessionNotFound)
+
+	require.NoError(t, store.Create(ctx, solauth.LoginSession{ID: "id", ExpiresAt: time.Now().Add(time.Minute)}))
+	waitCtx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+	defer cancel()
+	_, err = store.Wait(waitCtx, "id")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.NoError(t, store.Claim(ctx, "id", "wallet"))
+	require.ErrorIs(t, store.Claim(ctx, "id", "another"), solauth.ErrLoginSessionCompleted)
+	require.ErrorIs(t, store.Complete(ctx, "id", "another", solauth.TokenResponse{}), solauth.ErrLoginSessionCompleted)
+	require.NoError(t, store.Complete(ctx, "id", "wallet", solauth.TokenResponse{Access: "access"}))
+	require.ErrorIs(t, store.Complete(ctx, "id", "wallet", solauth.TokenResponse{}), solauth.ErrLoginSessionCompleted)
+
+	session, err := store.Wait(ctx, "id")
+	require.NoError(t, err)
+	require.Equal(t, "wallet", session.Wallet)
+	require.Equal(t, "access", session.Tokens.Access)
+
+	// the tokens are delivered once
+	_, err = store.Wait(ctx, "id")
+	require.ErrorIs(t, err, solauth.ErrLoginSessionNotFound)
+
+	t.Run("limit", func(t *testing.T) {
+		store := solauth.NewMemoryLoginSessionStore(1)
+
+		require.NoError(t, store.Create(ctx, solauth.LoginSession{ID: "first", ExpiresAt: time.Now().Add(time.Millisecond * 10)}))
+		require.ErrorIs(t, store.Create(ctx, solauth.LoginSession{ID: "second", ExpiresAt: time.Now().Add(time.Minute)}), solauth.ErrTooManyLoginSessions)
+
+		// the expired session frees the place
+		time.Sleep(time.Millisecond * 20)
+		require.NoError(t, store.Create(ctx, solauth.LoginSession{ID: "second", ExpiresAt: time.Now().Add(time.Minute)}))
+	})
+}
+
+func TestLoginSession(t *testing.T) {
+	walletAddr := wallet.PublicKey.ToBase58()
+	store := solauth.NewMemoryLoginSessionStore(0)
+	j := solauth.NewJWT(authSigningKey)
+	challenger := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0)
+
+	create := solauth.CreateLoginSession(store, "https://example.com/login?ref=qr", 0)
+	challenge := solauth.LoginSessionChallenge(store, challenger)
+	verify := solauth.VerifyLoginSession(store, challenger, j)
+	tokens := solauth.LoginSessionTokens(store, time.Millisecond*50)
+
+	post := func(handler http.HandlerFunc, payload interface{}) *httptest.ResponseRecorder {
+		jsonData, err := json.Marshal(payload)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(jsonData)))
+		return rr
+	}
+
+	newSession := func() (id, secret string) {
+		rr := httptest.NewRecorder()
+		create(rr, httptest.NewRequest(http.MethodPost, "/auth/qr", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp struct {
+			SessionID string `json:"session_id"`
+			Secret    string `json:"secret"`
+			URL       string `json:"url"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.NotEmpty(t, resp.SessionID)
+		require.NotEmpty(t, resp.Secret)
+
+		u, err := url.Parse(resp.URL)
+		require.NoError(t, err)
+		require.Equal(t, "qr", u.Query().Get("ref"))
+		require.Equal(t, resp.SessionID, u.Query().Get("session_id"))
+
+		return resp.SessionID, resp.Secret
+	}
+
+	signIn := func(id string) *httptest.ResponseRecorder {
+		rr := post(challenge, map[string]string{"session_id": id, "public_key": walletAddr})
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var c struct {
+			Message string `json:"message"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&c))
+
+		return post(verify, map[string]string{
+			"session_id": id,
+			"public_key": walletAddr,
+			"message":    c.Message,
+			"signature":  base64.StdEncoding.EncodeToString(wallet.Sign([]byte(c.Message))),
+		})
+	}
+
+	poll := func(id, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth/qr/tokens?session_id="+url.QueryEscape(id), nil)
+		req.Header.Set(solauth.LoginSessionSecretHeader, secret)
+
+		rr := httptest.NewRecorder()
+		tokens(rr, req)
+		return rr
+	}
+
+	t.Run("long polling", func(t *testing.T) {
+		id, secret := newSession()
+
+		require.Equal(t, http.StatusNotFound, poll(id, "wrong").Code)
+
+		// the secret in the query string is accepted for the event stream only
+		rr := httptest.NewRecorder()
+		tokens(rr, httptest.NewRequest(http.MethodGet, "/auth/qr/tokens?session_id="+id+"&secret="+secret, nil))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = poll(id, secret)
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		require.JSONEq(t, `{"status": "pending"}`, rr.Body.String())
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			// wait longer than the poll timeout
+			waiting := solauth.LoginSessionTokens(store, time.Second*5)
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/auth/qr/tokens?session_id="+id, nil)
+			req.Header.Set(solauth.LoginSessionSecretHeader, secret)
+			waiting(rr, req)
+			done <- rr
+		}()
+
+		require.Equal(t, http.StatusNoContent, signIn(id).Code)
+		// the session is completed once
+		require.Equal(t, http.StatusConflict, post(challenge, map[string]string{"session_id": id, "public_key": walletAddr}).Code)
+
+		rr = <-done
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp solauth.TokenResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		claims, err := j.VerifyAccessToken(resp.Access)
+		require.NoError(t, err)
+		require.Equal(t, walletAddr, claims.Wallet)
+
+		// the tokens are delivered once
+		require.Equal(t, http.StatusNotFound, poll(id, secret).Code)
+	})
+
+	t.Run("server-sent events", func(t *testing.T) {
+		id, secret := newSession()
+		require.Equal(t, http.StatusNoContent, signIn(id).Code)
+
+		// EventSource sends the secret in the query string
+		req := httptest.NewRequest(http.MethodGet, "/auth/qr/tokens?"+url.Values{
+			"session_id": {id},
+			"secret":     {secret},
+		}.Encode(), nil)
+		req.Header.Set("Accept", "text/event-stream")
+		rr := httptest.NewRecorder()
+		tokens(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+
+		scanner := bufio.NewScanner(rr.Body)
+		require.True(t, scanner.Scan())
+		require.Equal(t, "event: tokens", scanner.Text())
+		require.True(t, scanner.Scan())
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		require.True(t, ok)
+
+		var resp solauth.TokenResponse
+		require.NoError(t, json.Unmarshal([]byte(data), &resp))
+		_, err := j.VerifyAccessToken(resp.Access)
+		require.NoError(t, err)
+	})
+
+	t.Run("challenge of another session", func(t *testing.T) {
+		id, _ := newSession()
+		other, _ := newSession()
+
+		rr := post(challenge, map[string]string{"session_id": other, "public_key": walletAddr})
+		require.Equal(t, http.StatusOK, rr.Code)
+		var c struct {
+			Message string `json:"message"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&c))
+		require.Contains(t, c.Message, "Request ID: "+other)
+
+		// the challenge issued without the session
+		plain, err := challenger.IssueChallenge(context.Background(), walletAddr)
+		require.NoError(t, err)
+
+		for _, message := range []string{c.Message, plain.Message} {
+			rr := post(verify, map[string]string{
+				"session_id": id,
+				"public_key": walletAddr,
+				"message":    message,
+				"signature":  base64.StdEncoding.EncodeToString(wallet.Sign([]byte(message))),
+			})
+			require.Equal(t, http.StatusUnauthorized, rr.Code)
+		}
+
+		// the session is still pending
+		require.Equal(t, http.StatusNoContent, signIn(id).Code)
+	})
+
+	t.Run("concurrent sign-in", func(t *testing.T) {
+		id, _ := newSession()
+		other := types.NewAccount()
+
+		var issued int32
+		counting := solauth.VerifyLoginSession(store, challenger, issueTokensFunc(func(ctx context.Context, walletAddr string) (solauth.TokenResponse, error) {
+			atomic.AddInt32(&issued, 1)
+			return j.IssueTokens(ctx, walletAddr)
+		}))
+
+		// both wallets get the challenges before any of them signs in
+		payloads := make([]map[string]string, 0, 2)
+		for _, account := range []types.Account{wallet, other} {
+			rr := post(challenge, map[string]string{"session_id": id, "public_key": account.PublicKey.ToBase58()})
+			require.Equal(t, http.StatusOK, rr.Code)
+			var c struct {
+				Message string `json:"message"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&c))
+			payloads = append(payloads, map[string]string{
+				"session_id": id,
+				"public_key": account.PublicKey.ToBase58(),
+				"message":    c.Message,
+				"signature":  base64.StdEncoding.EncodeToString(account.Sign([]byte(c.Message))),
+			})
+		}
+
+		codes := make(chan int, len(payloads))
+		for _, payload := range payloads {
+			go func(payload map[string]string) {
+				jsonData, _ := json.Marshal(payload)
+				rr := httptest.NewRecorder()
+				counting(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(jsonData)))
+				codes <- rr.Code
+			}(payload)
+		}
+		results := []int{<-codes, <-codes}
+		require.ElementsMatch(t, []int{http.StatusNoContent, http.StatusConflict}, results)
+		// the tokens are issued for the winner only
+		require.Equal(t, int32(1), atomic.LoadInt32(&issued))
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, post(challenge, map[string]string{"session_id": "unknown", "public_key": walletAddr}).Code)
+		require.Equal(t, http.StatusNotFound, poll("unknown", "secret").Code)
+	})
+
+	t.Run("expired session", func(t *testing.T) {
+		create := solauth.CreateLoginSession(store, "https://example.com/login", time.Millisecond*10)
+		rr := httptest.NewRecorder()
+		create(rr, httptest.NewRequest(http.MethodPost, "/auth/qr", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var resp struct {
+			SessionID string `json:"session_id"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+		time.Sleep(time.Millisecond * 20)
+		require.Equal(t, http.StatusNotFound, post(challenge, map[string]string{"session_id": resp.SessionID, "public_key": walletAddr}).Code)
+	})
+}
+
+// issueTokensFunc is the function adapter for the token issuer.
+type issueTokensFunc func(ctx context.Context, walletAddr string) (solauth.TokenResponse, error)
+
+func (f issueTokensFunc) IssueTokens(ctx context.Context, walletAddr string) (solauth.TokenResponse, error) {
+	return f(ctx, walletAddr)
+}
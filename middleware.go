@@ -2,6 +2,8 @@ package solauth
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/go-kit/kit/auth/jwt"
@@ -9,8 +11,8 @@ import (
 )
 
 type (
-	verifier interface {
-		VerifyToken(tokenString string) (*Claims, error)
+	accessTokenVerifier interface {
+		VerifyAccessToken(tokenString string) (*Claims, error)
 	}
 
 	contextKey struct{ name string }
@@ -37,23 +39,118 @@ func GetClaimsFromContext(ctx context.Context) *Claims {
 	return claims
 }
 
+// MiddlewareOption is the option for Middleware.
+type MiddlewareOption func(*middlewareOptions)
+
+// middlewareOptions is the set of Middleware options.
+type middlewareOptions struct {
+	extractor    TokenExtractor
+	optional     bool
+	errorHandler ErrorHandler
+}
+
+// ErrorHandler writes the response when the request can't be authorized.
+// The error is ErrUnauthorized if there is no token in the request,
+// and wraps ErrInvalidToken and the verification error otherwise.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// WithTokenExtractor sets the function to extract the token from the request.
+// Default is DefaultTokenExtractor. Use ChainTokenExtractors to try several sources.
+func WithTokenExtractor(e TokenExtractor) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.extractor = e
+	}
+}
+
+// WithOptionalAuth makes the authentication optional: the claims are added
+// to the request context if the token is valid, otherwise the request
+// passes through without them. Use GetClaimsFromRequest to check.
+func WithOptionalAuth() MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.optional = true
+	}
+}
+
+// WithErrorHandler sets the function to respond to the unauthorized requests.
+// Default is PlainTextErrorHandler, use JSONErrorHandler to respond
+// with the same JSON error envelope as the handlers.
+func WithErrorHandler(h ErrorHandler) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.errorHandler = h
+	}
+}
+
+// PlainTextErrorHandler responds with the plain text "Unauthorized".
+func PlainTextErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", authenticateHeader(err))
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// JSONErrorHandler responds with the JSON error envelope, e.g.:
+//
+//	{"code": 401, "error": "Invalid or expired token: token is expired"}
+//
+// The WWW-Authenticate header has the "invalid_token" error code (RFC 6750)
+// if the token is present but invalid.
+func JSONErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", authenticateHeader(err))
+	defaultResponse(w, http.StatusUnauthorized, map[string]interface{}{
+		"code":  http.StatusUnauthorized,
+		"error": err.Error(),
+	})
+}
+
+// authenticateHeader returns the WWW-Authenticate header value for the error.
+func authenticateHeader(err error) string {
+	if errors.Is(err, ErrInvalidToken) {
+		return fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, ErrInvalidToken.Error())
+	}
+	return "Bearer"
+}
+
+// newMiddlewareOptions returns the options with the defaults applied.
+func newMiddlewareOptions(opts ...MiddlewareOption) middlewareOptions {
+	o := middlewareOptions{
+		extractor:    DefaultTokenExtractor(),
+		errorHandler: PlainTextErrorHandler,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
 // Middleware is a middleware for SolAuth.
-// It will check the request for a valid token and
+// It will check the request for a valid access token and
 // add the claims to the request context.
-func Middleware(v verifier) func(http.Handler) http.Handler {
+// Refresh tokens are rejected.
+func Middleware(v accessTokenVerifier, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	o := newMiddlewareOptions(opts...)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get token from request
-			token := r.Header.Get("Authorization")
+			token := o.extractor(r)
 			if token == "" {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				if o.optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				o.errorHandler(w, r, ErrUnauthorized)
 				return
 			}
 
 			// Validate token
-			claims, err := v.VerifyToken(token)
+			claims, err := v.VerifyAccessToken(token)
 			if err != nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				if o.optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if !errors.Is(err, ErrInvalidToken) {
+					err = fmt.Errorf("%w: %w", ErrInvalidToken, err)
+				}
+				o.errorHandler(w, r, err)
 				return
 			}
 
@@ -65,9 +162,11 @@ func Middleware(v verifier) func(http.Handler) http.Handler {
 }
 
 // GoKitMiddleware is a middleware for SolAuth.
-// It will check the context for a valid token and
+// It will check the context for a valid access token and
 // add the claims to the context.
-func GoKitMiddleware(v verifier) endpoint.Middleware {
+// Refresh tokens are rejected.
+// Use HTTPToContext as the server request function to put the token to the context.
+func GoKitMiddleware(v accessTokenVerifier) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 			token, ok := ctx.Value(jwt.JWTContextKey).(string)
@@ -76,7 +175,7 @@ func GoKitMiddleware(v verifier) endpoint.Middleware {
 			}
 
 			// Validate token
-			claims, err := v.VerifyToken(token)
+			claims, err := v.VerifyAccessToken(token)
 			if err != nil {
 				return nil, ErrUnauthorized
 			}
@@ -0,0 +1,129 @@
+package solauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	j := solauth.NewJWT(authSigningKey)
+	tokens, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	handler := solauth.Middleware(j)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, wallet.PublicKey.ToBase58(), solauth.GetClaimsFromRequest(r).Wallet)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for token, status := range map[string]int{
+		tokens.Access:  http.StatusOK,
+		tokens.Refresh: http.StatusUnauthorized,
+		"":             http.StatusUnauthorized,
+		"invalid":      http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, status, rr.Code)
+	}
+}
+
+func TestMiddlewareOptionalAuth(t *testing.T) {
+	j := solauth.NewJWT(authSigningKey)
+	tokens, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	handler := solauth.Middleware(j, solauth.WithOptionalAuth())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims := solauth.GetClaimsFromRequest(r); claims != nil {
+			_, _ = w.Write([]byte(claims.Wallet))
+		}
+	}))
+
+	for token, body := range map[string]string{
+		tokens.Access:  wallet.PublicKey.ToBase58(),
+		tokens.Refresh: "",
+		"invalid":      "",
+		"":             "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, body, rr.Body.String())
+	}
+}
+
+func TestMiddlewareErrorHandler(t *testing.T) {
+	j := solauth.NewJWT(authSigningKey)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("json", func(t *testing.T) {
+		handler := solauth.Middleware(j, solauth.WithErrorHandler(solauth.JSONErrorHandler))(ok)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+
+		req.Header.Set("Authorization", "Bearer invalid")
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Contains(t, rr.Header().Get("Content-Type"), "application/json")
+		require.Equal(t, `Bearer error="invalid_token", error_description="Invalid or expired token"`, rr.Header().Get("WWW-Authenticate"))
+
+		var resp map[string]interface{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		require.EqualValues(t, http.StatusUnauthorized, resp["code"])
+		require.Contains(t, resp["error"], solauth.ErrInvalidToken.Error())
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		var handled error
+		handler := solauth.Middleware(j, solauth.WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			w.WriteHeader(http.StatusTeapot)
+		}))(ok)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer invalid")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusTeapot, rr.Code)
+		require.ErrorIs(t, handled, solauth.ErrInvalidToken)
+	})
+}
+
+func TestGoKitMiddleware(t *testing.T) {
+	j := solauth.NewJWT(authSigningKey)
+	tokens, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	endpoint := solauth.GoKitMiddleware(j)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return solauth.GetClaimsFromContext(ctx).Wallet, nil
+	})
+
+	resp, err := endpoint(context.WithValue(context.Background(), kitjwt.JWTContextKey, tokens.Access), nil)
+	require.NoError(t, err)
+	require.Equal(t, wallet.PublicKey.ToBase58(), resp)
+
+	_, err = endpoint(context.WithValue(context.Background(), kitjwt.JWTContextKey, tokens.Refresh), nil)
+	require.ErrorIs(t, err, solauth.ErrUnauthorized)
+
+	_, err = endpoint(context.Background(), nil)
+	require.ErrorIs(t, err, solauth.ErrUnauthorized)
+}
@@ -0,0 +1,352 @@
+package solauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mr-tron/base58"
+	"github.com/portto/solana-go-sdk/common"
+)
+
+// SquadsProgramID is the ID of the Squads v4 multisig program.
+const SquadsProgramID = "SQDS4ep65T869zMMBKyuUq6aD6EgTu8psMjkvj52pCf"
+
+// Permissions of the multisig members.
+const (
+	MultisigPermissionInitiate uint8 = 1 << iota
+	MultisigPermissionVote
+	MultisigPermissionExecute
+)
+
+// multisigDiscriminator is the Anchor discriminator of the Squads v4 multisig account.
+var multisigDiscriminator = func() []byte {
+	sum := sha256.Sum256([]byte("account:Multisig"))
+	return sum[:8]
+}()
+
+// Multisig is the Squads v4 multisig account.
+type Multisig struct {
+	// Address is the address of the multisig account.
+	Address string
+	// Threshold is the number of the approvals required by the multisig.
+	Threshold uint16
+	// Members is the members of the multisig.
+	Members []MultisigMember
+}
+
+// MultisigMember is the member of the multisig.
+type MultisigMember struct {
+	// Key is the wallet address of the member.
+	Key string
+	// Permissions is the bit mask of the MultisigPermission* values.
+	Permissions uint8
+}
+
+// CanVote reports whether the member's approval counts towards the threshold.
+func (m MultisigMember) CanVote() bool {
+	return m.Permissions&MultisigPermissionVote != 0
+}
+
+// ParseMultisig decodes the Squads v4 multisig account data.
+func ParseMultisig(address string, data []byte) (*Multisig, error) {
+	if !bytes.HasPrefix(data, multisigDiscriminator) {
+		return nil, fmt.Errorf("%w: not a multisig account", ErrInvalidMultisig)
+	}
+
+	r := borshReader{data: data[len(multisigDiscriminator):]}
+	r.skip(32 + 32) // create key, config authority
+	m := &Multisig{Address: address, Threshold: r.u16()}
+	r.skip(4 + 8 + 8) // time lock, transaction index, stale transaction index
+	if r.u8() == 1 {
+		r.skip(32) // rent collector
+	}
+	r.skip(1) // bump
+	n := int(r.u32())
+	for i := 0; i < n && !r.err; i++ {
+		key := r.bytes(32)
+		m.Members = append(m.Members, MultisigMember{
+			Key:         base58.Encode(key),
+			Permissions: r.u8(),
+		})
+	}
+	if r.err {
+		return nil, fmt.Errorf("%w: account data is too short", ErrInvalidMultisig)
+	}
+
+	return m, nil
+}
+
+// FetchMultisig fetches the Squads v4 multisig account with the given address.
+func FetchMultisig(ctx context.Context, client RPCClient, address string) (*Multisig, error) {
+	var res struct {
+		Value *struct {
+			Owner string   `json:"owner"`
+			Data  []string `json:"data"`
+		} `json:"value"`
+	}
+	if err := client.Call(ctx, "getAccountInfo", []interface{}{
+		address,
+		map[string]string{"encoding": "base64", "commitment": "confirmed"},
+	}, &res); err != nil {
+		return nil, err
+	}
+
+	if res.Value == nil {
+		return nil, fmt.Errorf("%w: account %s not found", ErrInvalidMultisig, address)
+	}
+	if res.Value.Owner != SquadsProgramID || len(res.Value.Data) == 0 {
+		return nil, fmt.Errorf("%w: account %s is not owned by the Squads program", ErrInvalidMultisig, address)
+	}
+	data, err := base64.StdEncoding.DecodeString(res.Value.Data[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid multisig account data: %w", err)
+	}
+
+	return ParseMultisig(address, data)
+}
+
+// VaultAddress returns the address of the multisig vault with the given index,
+// the vault with index 0 is the default one.
+func (m *Multisig) VaultAddress(index uint8) (string, error) {
+	multisig, err := base58.Decode(m.Address)
+	if err != nil {
+		return "", fmt.Errorf("invalid multisig address: %w", err)
+	}
+
+	vault, _, err := common.FindProgramAddress([][]byte{
+		[]byte("multisig"),
+		multisig,
+		[]byte("vault"),
+		{index},
+	}, common.PublicKeyFromString(SquadsProgramID))
+	if err != nil {
+		return "", fmt.Errorf("failed to derive vault address: %w", err)
+	}
+
+	return vault.ToBase58(), nil
+}
+
+// MemberSignature is the signature of the message by the multisig member.
+type MemberSignature struct {
+	// PublicKey is the public key of the member.
+	PublicKey string `json:"public_key"`
+	// Signature is the signature of the message, the encoding is detected automatically.
+	Signature string `json:"signature"`
+}
+
+// VerifySignatures verifies the signatures of the message by the members
+// with the vote permission and returns the addresses of the signers.
+// It returns error wrapping ErrMultisigThreshold if the number of the valid
+// signatures of the distinct members is below the threshold.
+func (m *Multisig) VerifySignatures(message string, signatures []MemberSignature) ([]string, error) {
+	voters := make(map[string]bool, len(m.Members))
+	for _, member := range m.Members {
+		if member.CanVote() {
+			voters[member.Key] = true
+		}
+	}
+
+	var signers []string
+	for _, s := range signatures {
+		publicKey, err := DecodePublicKey(s.PublicKey, EncodingAuto)
+		if err != nil {
+			return nil, err
+		}
+		addr := base58.Encode(publicKey)
+		if !voters[addr] {
+			return nil, fmt.Errorf("%w: %s", ErrNotMultisigMember, addr)
+		}
+		if containsAll(signers, []string{addr}) {
+			continue
+		}
+
+		signature, err := DecodeSignature(s.Signature, EncodingAuto)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := VerifyMessageSignature(message, signature, publicKey); err != nil {
+			return nil, fmt.Errorf("invalid signature of member %s: %w", addr, err)
+		}
+		signers = append(signers, addr)
+	}
+
+	if m.Threshold == 0 || len(signers) < int(m.Threshold) {
+		return nil, fmt.Errorf("%w: %d of %d", ErrMultisigThreshold, len(signers), m.Threshold)
+	}
+
+	return signers, nil
+}
+
+// CheckSigners checks that all signers are the members with the vote permission
+// and their number meets the threshold.
+func (m *Multisig) CheckSigners(signers []string) error {
+	voters := make(map[string]bool, len(m.Members))
+	for _, member := range m.Members {
+		if member.CanVote() {
+			voters[member.Key] = true
+		}
+	}
+
+	for _, addr := range signers {
+		if !voters[addr] {
+			return fmt.Errorf("%w: %s", ErrNotMultisigMember, addr)
+		}
+	}
+	if m.Threshold == 0 || len(signers) < int(m.Threshold) {
+		return fmt.Errorf("%w: %d of %d", ErrMultisigThreshold, len(signers), m.Threshold)
+	}
+
+	return nil
+}
+
+// multisigContextKey is the key for the multisig signers in the context.
+var multisigContextKey = &contextKey{name: "multisig"}
+
+// multisigSigners is the multisig and its members who signed in.
+type multisigSigners struct {
+	multisig string
+	signers  []string
+}
+
+// withMultisigSigners returns the context with the multisig signers,
+// IssueTokens adds them to the token claims.
+func withMultisigSigners(ctx context.Context, multisig string, signers []string) context.Context {
+	return context.WithValue(ctx, multisigContextKey, multisigSigners{multisig: multisig, signers: signers})
+}
+
+// multisigSignersFromContext returns the multisig signers from the context.
+func multisigSignersFromContext(ctx context.Context) multisigSigners {
+	s, _ := ctx.Value(multisigContextKey).(multisigSigners)
+	return s
+}
+
+// VerifyMultisigPayload is the payload for the multisig verification.
+type VerifyMultisigPayload struct {
+	// Multisig is the address of the Squads multisig account.
+	Multisig string `json:"multisig"`
+	// VaultIndex is the index of the vault to sign in as, 0 by default.
+	VaultIndex uint8 `json:"vault_index,omitempty"`
+	// Message is the challenge issued by RequestAuth for the vault address.
+	Message string `json:"message"`
+	// Signatures is the signatures of the message by the multisig members.
+	Signatures []MemberSignature `json:"signatures"`
+}
+
+// Validate validates the payload.
+func (p *VerifyMultisigPayload) Validate() error {
+	if p.Multisig == "" {
+		return fmt.Errorf("multisig is required")
+	}
+	if p.Message == "" {
+		return fmt.Errorf("message is required")
+	}
+	if len(p.Signatures) == 0 {
+		return fmt.Errorf("signatures are required")
+	}
+	return nil
+}
+
+// VerifyMultisig is the handler for the Squads multisig vaults, which have no private key.
+// The challenge must be issued by RequestAuth for the vault address
+// and signed by at least the threshold number of the members with the vote permission.
+// The multisig account is fetched with the RPC client on every sign-in,
+// so the current threshold and members are applied. The JWT must be configured
+// with WithMultisigClient to check the signers again on refresh.
+// It returns tokens of the vault wallet with the signing members in the "signers" claim.
+func VerifyMultisig(challenger interface {
+	VerifyChallenge(ctx context.Context, publicKey, message string) error
+}, jwt interface {
+	IssueTokens(ctx context.Context, walletAddr string) (TokenResponse, error)
+}, client RPCClient, opts ...HandlerOption,
+) http.HandlerFunc {
+	o := newHandlerOptions(opts...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse JSON request
+		var payload VerifyMultisigPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Validate the payload
+		if err := payload.Validate(); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Fetch the multisig and derive the vault address
+		multisig, err := FetchMultisig(r.Context(), client, payload.Multisig)
+		if errors.Is(err, ErrInvalidMultisig) {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"code":  http.StatusInternalServerError,
+				"error": fmt.Sprintf("failed to fetch multisig: %s", err),
+			})
+			return
+		}
+		vault, err := multisig.VaultAddress(payload.VaultIndex)
+		if err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Verify the member signatures
+		signers, err := multisig.VerifySignatures(payload.Message, payload.Signatures)
+		if err != nil {
+			defaultResponse(w, http.StatusUnauthorized, map[string]interface{}{
+				"code":  http.StatusUnauthorized,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Consume the challenge
+		if err := challenger.VerifyChallenge(r.Context(), vault, payload.Message); err != nil {
+			defaultResponse(w, http.StatusUnauthorized, map[string]interface{}{
+				"code":  http.StatusUnauthorized,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Check the wallet policy and the access requirements
+		ctx, ok := o.checkAccess(w, r, vault)
+		if !ok {
+			return
+		}
+
+		// Issue tokens
+		tokens, err := jwt.IssueTokens(withMultisigSigners(ctx, multisig.Address, signers), vault)
+		if err != nil {
+			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"code":  http.StatusInternalServerError,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		defaultResponse(w, http.StatusOK, tokens)
+	}
+}
@@ -0,0 +1,161 @@
+package solauth_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/portto/solana-go-sdk/common"
+	"github.com/portto/solana-go-sdk/types"
+	"github.com/stretchr/testify/require"
+)
+
+// multisigAccount returns the Borsh encoded Squads v4 multisig account.
+func multisigAccount(threshold uint16, members ...solauth.MultisigMember) []byte {
+	discriminator := sha256.Sum256([]byte("account:Multisig"))
+
+	data := append([]byte{}, discriminator[:8]...)
+	data = append(data, types.NewAccount().PublicKey.Bytes()...) // create key
+	data = append(data, make([]byte, 32)...)                     // config authority
+	data = binary.LittleEndian.AppendUint16(data, threshold)
+	data = binary.LittleEndian.AppendUint32(data, 0) // time lock
+	data = binary.LittleEndian.AppendUint64(data, 5) // transaction index
+	data = binary.LittleEndian.AppendUint64(data, 3) // stale transaction index
+	data = append(data, 1)                           // rent collector
+	data = append(data, types.NewAccount().PublicKey.Bytes()...)
+	data = append(data, 254) // bump
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(members)))
+	for _, member := range members {
+		data = append(data, common.PublicKeyFromString(member.Key).Bytes()...)
+		data = append(data, member.Permissions)
+	}
+	return data
+}
+
+// handleMultisig registers the canned getAccountInfo response of the multisig account.
+func handleMultisig(t *testing.T, rpc *fakeRPC, address, owner string, data []byte) {
+	rpc.handle("getAccountInfo", func(params json.RawMessage) (interface{}, *solauth.RPCError) {
+		var p []json.RawMessage
+		require.NoError(t, json.Unmarshal(params, &p))
+		require.JSONEq(t, `"`+address+`"`, string(p[0]))
+
+		return map[string]interface{}{
+			"context": map[string]interface{}{"slot": 1},
+			"value": map[string]interface{}{
+				"owner":      owner,
+				"data":       []string{base64.StdEncoding.EncodeToString(data), "base64"},
+				"executable": false,
+				"lamports":   1000000,
+			},
+		}, nil
+	})
+}
+
+func TestVerifyMultisig(t *testing.T) {
+	alice, bob, carol, dave := types.NewAccount(), types.NewAccount(), types.NewAccount(), types.NewAccount()
+	all := solauth.MultisigPermissionInitiate | solauth.MultisigPermissionVote | solauth.MultisigPermissionExecute
+	multisigAddr := types.NewAccount().PublicKey.ToBase58()
+
+	rpc := newFakeRPC(t)
+	handleMultisig(t, rpc, multisigAddr, solauth.SquadsProgramID, multisigAccount(2,
+		solauth.MultisigMember{Key: alice.PublicKey.ToBase58(), Permissions: all},
+		solauth.MultisigMember{Key: bob.PublicKey.ToBase58(), Permissions: all},
+		solauth.MultisigMember{Key: carol.PublicKey.ToBase58(), Permissions: solauth.MultisigPermissionVote},
+		solauth.MultisigMember{Key: dave.PublicKey.ToBase58(), Permissions: solauth.MultisigPermissionInitiate},
+	))
+	client := solauth.NewJSONRPCClient(rpc.URL, nil)
+
+	multisig, err := solauth.FetchMultisig(context.Background(), client, multisigAddr)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, multisig.Threshold)
+	require.Len(t, multisig.Members, 4)
+	require.Equal(t, alice.PublicKey.ToBase58(), multisig.Members[0].Key)
+	require.False(t, multisig.Members[3].CanVote())
+
+	vault, err := multisig.VaultAddress(0)
+	require.NoError(t, err)
+	require.NotEqual(t, multisigAddr, vault)
+	otherVault, err := multisig.VaultAddress(1)
+	require.NoError(t, err)
+	require.NotEqual(t, vault, otherVault)
+
+	j := solauth.NewJWT(authSigningKey,
+		solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()),
+		solauth.WithMultisigClient(client),
+	)
+	challenger := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0)
+	handler := solauth.VerifyMultisig(challenger, j, client)
+
+	verify := func(signers ...types.Account) *httptest.ResponseRecorder {
+		challenge, err := challenger.IssueChallenge(context.Background(), vault)
+		require.NoError(t, err)
+
+		payload := solauth.VerifyMultisigPayload{Multisig: multisigAddr, Message: challenge.Message}
+		for _, s := range signers {
+			payload.Signatures = append(payload.Signatures, solauth.MemberSignature{
+				PublicKey: s.PublicKey.ToBase58(),
+				Signature: base64.StdEncoding.EncodeToString(s.Sign([]byte(challenge.Message))),
+			})
+		}
+		jsonData, err := json.Marshal(payload)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/auth/verify/multisig", bytes.NewReader(jsonData)))
+		return rr
+	}
+
+	// below the threshold, the duplicate signature is counted once
+	require.Equal(t, http.StatusUnauthorized, verify(alice, alice).Code)
+	// the member without the vote permission
+	require.Equal(t, http.StatusUnauthorized, verify(alice, dave).Code)
+	// not a member
+	require.Equal(t, http.StatusUnauthorized, verify(alice, wallet).Code)
+
+	rr := verify(alice, carol)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var tokens solauth.TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&tokens))
+	claims, err := j.VerifyAccessToken(tokens.Access)
+	require.NoError(t, err)
+	require.Equal(t, vault, claims.Wallet)
+	require.Equal(t, multisigAddr, claims.Multisig)
+	require.Equal(t, []string{alice.PublicKey.ToBase58(), carol.PublicKey.ToBase58()}, claims.Signers)
+
+	// the signers are kept on refresh
+	refreshed, err := j.RefreshToken(context.Background(), tokens.Refresh)
+	require.NoError(t, err)
+	claims, err = j.VerifyAccessToken(refreshed.Access)
+	require.NoError(t, err)
+	require.Equal(t, multisigAddr, claims.Multisig)
+	require.Len(t, claims.Signers, 2)
+
+	// the signers are checked against the current members on refresh
+	handleMultisig(t, rpc, multisigAddr, solauth.SquadsProgramID, multisigAccount(2,
+		solauth.MultisigMember{Key: alice.PublicKey.ToBase58(), Permissions: all},
+		solauth.MultisigMember{Key: bob.PublicKey.ToBase58(), Permissions: all},
+	))
+	_, err = j.RefreshToken(context.Background(), refreshed.Refresh)
+	require.ErrorIs(t, err, solauth.ErrRefreshTokenRevoked)
+	rr = httptest.NewRecorder()
+	solauth.RefreshToken(j)(rr, httptest.NewRequest(http.MethodPost, "/auth/refresh",
+		bytes.NewReader([]byte(`{"refresh_token":"`+refreshed.Refresh+`"}`))))
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// the multisig tokens can't be refreshed without the client
+	_, err = solauth.NewJWT(authSigningKey).RefreshToken(context.Background(), tokens.Refresh)
+	require.ErrorIs(t, err, solauth.ErrRefreshTokenRevoked)
+
+	t.Run("not a multisig account", func(t *testing.T) {
+		handleMultisig(t, rpc, multisigAddr, solauth.TokenProgramID, multisigAccount(2))
+		require.Equal(t, http.StatusBadRequest, verify(alice, bob).Code)
+	})
+}
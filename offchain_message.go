@@ -0,0 +1,197 @@
+package solauth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+// OffchainSigningDomain is the prefix of every Solana off-chain message.
+// It can't be a valid transaction prefix, so a signed off-chain message
+// can never be used as a signed transaction.
+const OffchainSigningDomain = "\xffsolana offchain"
+
+// OffchainMessageVersion is the supported header version of the off-chain message.
+const OffchainMessageVersion = 0
+
+// OffchainMessageFormat is the format of the off-chain message body.
+type OffchainMessageFormat uint8
+
+// Supported off-chain message formats.
+const (
+	// OffchainFormatRestrictedASCII is printable ASCII characters only,
+	// limited to the size a Ledger device can handle.
+	OffchainFormatRestrictedASCII OffchainMessageFormat = iota
+	// OffchainFormatLimitedUTF8 is any UTF-8 text,
+	// limited to the size a Ledger device can handle.
+	OffchainFormatLimitedUTF8
+	// OffchainFormatExtendedUTF8 is any UTF-8 text up to the maximum size.
+	OffchainFormatExtendedUTF8
+)
+
+const (
+	offchainPacketSize = 1232
+	offchainMaxSize    = 65535
+)
+
+// OffchainMessage is the message signed according to the Solana off-chain
+// message signing spec. The signed bytes are:
+// signing domain, header version, application domain, message format,
+// signers count, signers and the length prefixed message body.
+type OffchainMessage struct {
+	// Version is the header version, only 0 is supported.
+	Version uint8
+	// ApplicationDomain is the 32 bytes identifier of the application.
+	ApplicationDomain [32]byte
+	// Format is the format of the message body.
+	Format OffchainMessageFormat
+	// Signers is the list of public keys which are expected to sign the message.
+	Signers [][]byte
+	// Body is the message itself.
+	Body []byte
+}
+
+// NewOffchainMessage creates a new off-chain message with the most restrictive
+// format suitable for the body.
+func NewOffchainMessage(body []byte, applicationDomain [32]byte, signers ...[]byte) (OffchainMessage, error) {
+	m := OffchainMessage{
+		Version:           OffchainMessageVersion,
+		ApplicationDomain: applicationDomain,
+		Signers:           signers,
+		Body:              body,
+	}
+
+	ledgerLimit := offchainPacketSize - m.preambleSize()
+	switch {
+	case len(body) <= ledgerLimit && isRestrictedASCII(body):
+		m.Format = OffchainFormatRestrictedASCII
+	case len(body) <= ledgerLimit && utf8.Valid(body):
+		m.Format = OffchainFormatLimitedUTF8
+	case utf8.Valid(body):
+		m.Format = OffchainFormatExtendedUTF8
+	default:
+		return OffchainMessage{}, fmt.Errorf("off-chain message body must be a valid UTF-8 text")
+	}
+
+	if err := m.Validate(); err != nil {
+		return OffchainMessage{}, err
+	}
+
+	return m, nil
+}
+
+// Validate checks the message header and the body against its format.
+func (m OffchainMessage) Validate() error {
+	if m.Version != OffchainMessageVersion {
+		return fmt.Errorf("unsupported off-chain message version: %d", m.Version)
+	}
+	if len(m.Signers) == 0 || len(m.Signers) > 255 {
+		return fmt.Errorf("off-chain message must have from 1 to 255 signers, got: %d", len(m.Signers))
+	}
+	for _, s := range m.Signers {
+		if len(s) != 32 {
+			return fmt.Errorf("invalid off-chain message signer size: %d", len(s))
+		}
+	}
+	if len(m.Body) == 0 {
+		return fmt.Errorf("off-chain message body is empty")
+	}
+
+	ledgerLimit := offchainPacketSize - m.preambleSize()
+	switch m.Format {
+	case OffchainFormatRestrictedASCII:
+		if len(m.Body) > ledgerLimit || !isRestrictedASCII(m.Body) {
+			return fmt.Errorf("off-chain message body doesn't match restricted ASCII format")
+		}
+	case OffchainFormatLimitedUTF8:
+		if len(m.Body) > ledgerLimit || !utf8.Valid(m.Body) {
+			return fmt.Errorf("off-chain message body doesn't match limited UTF-8 format")
+		}
+	case OffchainFormatExtendedUTF8:
+		if len(m.Body) > offchainMaxSize-m.preambleSize() || !utf8.Valid(m.Body) {
+			return fmt.Errorf("off-chain message body doesn't match extended UTF-8 format")
+		}
+	default:
+		return fmt.Errorf("unsupported off-chain message format: %d", m.Format)
+	}
+
+	return nil
+}
+
+// Encode returns the bytes to sign.
+func (m OffchainMessage) Encode() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, m.preambleSize()+len(m.Body)))
+	buf.WriteString(OffchainSigningDomain)
+	buf.WriteByte(m.Version)
+	buf.Write(m.ApplicationDomain[:])
+	buf.WriteByte(byte(m.Format))
+	buf.WriteByte(byte(len(m.Signers)))
+	for _, s := range m.Signers {
+		buf.Write(s)
+	}
+	binary.Write(buf, binary.LittleEndian, uint16(len(m.Body))) //nolint:errcheck
+	buf.Write(m.Body)
+
+	return buf.Bytes(), nil
+}
+
+// DecodeOffchainMessage decodes the signed bytes of the off-chain message.
+func DecodeOffchainMessage(data []byte) (OffchainMessage, error) {
+	var m OffchainMessage
+
+	if !bytes.HasPrefix(data, []byte(OffchainSigningDomain)) {
+		return m, fmt.Errorf("missing off-chain message signing domain")
+	}
+	data = data[len(OffchainSigningDomain):]
+
+	// version + application domain + format + signers count
+	if len(data) < 1+32+1+1 {
+		return m, fmt.Errorf("off-chain message header is too short")
+	}
+	m.Version = data[0]
+	copy(m.ApplicationDomain[:], data[1:33])
+	m.Format = OffchainMessageFormat(data[33])
+	count := int(data[34])
+	data = data[35:]
+
+	if len(data) < count*32+2 {
+		return m, fmt.Errorf("off-chain message header is too short")
+	}
+	for i := 0; i < count; i++ {
+		m.Signers = append(m.Signers, data[:32])
+		data = data[32:]
+	}
+
+	size := int(binary.LittleEndian.Uint16(data[:2]))
+	data = data[2:]
+	if len(data) != size {
+		return m, fmt.Errorf("off-chain message body length mismatch: expected %d, got %d", size, len(data))
+	}
+	m.Body = data
+
+	if err := m.Validate(); err != nil {
+		return m, err
+	}
+
+	return m, nil
+}
+
+// preambleSize returns the size of the message without its body.
+func (m OffchainMessage) preambleSize() int {
+	return len(OffchainSigningDomain) + 1 + 32 + 1 + 1 + len(m.Signers)*32 + 2
+}
+
+// isRestrictedASCII reports whether b consists of printable ASCII characters only.
+func isRestrictedASCII(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package solauth_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/portto/solana-go-sdk/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffchainMessage(t *testing.T) {
+	signer := wallet.PublicKey.Bytes()
+
+	t.Run("format detection", func(t *testing.T) {
+		for body, format := range map[string]solauth.OffchainMessageFormat{
+			"Hello, world!":                  solauth.OffchainFormatRestrictedASCII,
+			"Sign in\nto the app":            solauth.OffchainFormatLimitedUTF8,
+			"Привет, мир!":                   solauth.OffchainFormatLimitedUTF8,
+			strings.Repeat("long text", 500): solauth.OffchainFormatExtendedUTF8,
+		} {
+			m, err := solauth.NewOffchainMessage([]byte(body), [32]byte{}, signer)
+			require.NoError(t, err)
+			require.Equal(t, format, m.Format, body)
+		}
+
+		_, err := solauth.NewOffchainMessage([]byte{0xff, 0xfe}, [32]byte{}, signer)
+		require.Error(t, err)
+	})
+
+	t.Run("encode and decode", func(t *testing.T) {
+		m, err := solauth.NewOffchainMessage([]byte("Hello, world!"), [32]byte{1, 2, 3}, signer)
+		require.NoError(t, err)
+
+		data, err := m.Encode()
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(string(data), solauth.OffchainSigningDomain))
+
+		decoded, err := solauth.DecodeOffchainMessage(data)
+		require.NoError(t, err)
+		require.Equal(t, m.ApplicationDomain, decoded.ApplicationDomain)
+		require.Equal(t, m.Format, decoded.Format)
+		require.Equal(t, m.Signers, decoded.Signers)
+		require.Equal(t, m.Body, decoded.Body)
+
+		_, err = solauth.DecodeOffchainMessage(data[:len(data)-1])
+		require.Error(t, err)
+
+		_, err = solauth.DecodeOffchainMessage([]byte("Hello, world!"))
+		require.Error(t, err)
+	})
+}
+
+func TestVerifyMessageSignature(t *testing.T) {
+	message := "Sign this message to login"
+	publicKey := wallet.PublicKey.Bytes()
+
+	t.Run("raw", func(t *testing.T) {
+		scheme, err := solauth.VerifyMessageSignature(message, wallet.Sign([]byte(message)), publicKey)
+		require.NoError(t, err)
+		require.Equal(t, solauth.SignatureSchemeRaw, scheme)
+	})
+
+	t.Run("offchain", func(t *testing.T) {
+		m, err := solauth.NewOffchainMessage([]byte(message), [32]byte{}, publicKey)
+		require.NoError(t, err)
+		data, err := m.Encode()
+		require.NoError(t, err)
+
+		scheme, err := solauth.VerifyMessageSignature(message, wallet.Sign(data), publicKey)
+		require.NoError(t, err)
+		require.Equal(t, solauth.SignatureSchemeOffchain, scheme)
+	})
+
+	t.Run("offchain with another format", func(t *testing.T) {
+		m := solauth.OffchainMessage{
+			Format:  solauth.OffchainFormatExtendedUTF8,
+			Signers: [][]byte{publicKey},
+			Body:    []byte(message),
+		}
+		data, err := m.Encode()
+		require.NoError(t, err)
+
+		scheme, err := solauth.VerifyMessageSignature(message, wallet.Sign(data), publicKey)
+		require.NoError(t, err)
+		require.Equal(t, solauth.SignatureSchemeOffchain, scheme)
+	})
+
+	t.Run("offchain envelope", func(t *testing.T) {
+		m, err := solauth.NewOffchainMessage([]byte(message), [32]byte{1, 2, 3}, types.NewAccount().PublicKey.Bytes(), publicKey)
+		require.NoError(t, err)
+		data, err := m.Encode()
+		require.NoError(t, err)
+
+		// the application domain and signers are unknown without the envelope
+		_, err = solauth.VerifyMessageSignature(message, wallet.Sign(data), publicKey)
+		require.Error(t, err)
+
+		scheme, err := solauth.VerifyOffchainEnvelope(message, data, wallet.Sign(data), publicKey)
+		require.NoError(t, err)
+		require.Equal(t, solauth.SignatureSchemeOffchain, scheme)
+
+		// the envelope of another message
+		_, err = solauth.VerifyOffchainEnvelope("another message", data, wallet.Sign(data), publicKey)
+		require.Error(t, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := solauth.VerifyMessageSignature(message, wallet.Sign([]byte("another message")), publicKey)
+		require.Error(t, err)
+	})
+}
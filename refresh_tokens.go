@@ -0,0 +1,128 @@
+package solauth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Security event types.
+const (
+	// SecurityEventRefreshTokenReuse is emitted when a refresh token
+	// which was already rotated is presented again. It means the token
+	// was most likely stolen, so the whole token family is revoked.
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+)
+
+// SecurityEvent is the event of a possible attack on the user session.
+type SecurityEvent struct {
+	Type    string    `json:"type"`
+	Wallet  string    `json:"wallet"`
+	Family  string    `json:"family,omitempty"`
+	TokenID string    `json:"token_id,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// SecurityEventHandler handles security events, e.g. logs them or notifies the user.
+type SecurityEventHandler func(ctx context.Context, event SecurityEvent)
+
+// RefreshTokenStore tracks refresh token families.
+// A family is the chain of refresh tokens rotated from the one issued on sign-in.
+// Only the latest token of the family can be used to refresh tokens.
+type RefreshTokenStore interface {
+	// Create starts a new family with the given token.
+	Create(ctx context.Context, family, tokenID string, expiresAt time.Time) error
+	// Rotate replaces the current token of the family with the new one.
+	// It must be atomic: only one of concurrent rotations of the same token succeeds.
+	// It returns ErrRefreshTokenReused if the used token is not the current one
+	// and ErrRefreshTokenRevoked if the family is revoked, expired or unknown.
+	Rotate(ctx context.Context, family, usedTokenID, newTokenID string, expiresAt time.Time) error
+	// Check checks the token is the current one of the family without rotating it.
+	// It returns the same errors as Rotate.
+	Check(ctx context.Context, family, tokenID string) error
+	// RevokeFamily revokes all tokens of the family.
+	RevokeFamily(ctx context.Context, family string) error
+}
+
+// refreshTokenFamily is the state of the refresh token family.
+type refreshTokenFamily struct {
+	current   string
+	revoked   bool
+	expiresAt time.Time
+}
+
+// MemoryRefreshTokenStore is the in-memory implementation of RefreshTokenStore.
+// It's suitable for a single instance deployment only.
+type MemoryRefreshTokenStore struct {
+	mu       sync.Mutex
+	families map[string]*refreshTokenFamily
+}
+
+// NewMemoryRefreshTokenStore creates a new in-memory refresh token store.
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		families: make(map[string]*refreshTokenFamily),
+	}
+}
+
+// Create starts a new family and drops all expired ones.
+func (s *MemoryRefreshTokenStore) Create(_ context.Context, family, tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, f := range s.families {
+		if !now.Before(f.expiresAt) {
+			delete(s.families, id)
+		}
+	}
+
+	s.families[family] = &refreshTokenFamily{current: tokenID, expiresAt: expiresAt}
+	return nil
+}
+
+// Rotate replaces the current token of the family with the new one.
+func (s *MemoryRefreshTokenStore) Rotate(_ context.Context, family, usedTokenID, newTokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.families[family]
+	if !ok || f.revoked || !time.Now().Before(f.expiresAt) {
+		return ErrRefreshTokenRevoked
+	}
+	if f.current != usedTokenID {
+		return ErrRefreshTokenReused
+	}
+
+	f.current = newTokenID
+	f.expiresAt = expiresAt
+	return nil
+}
+
+// Check checks the token is the current one of the family.
+func (s *MemoryRefreshTokenStore) Check(_ context.Context, family, tokenID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.families[family]
+	if !ok || f.revoked || !time.Now().Before(f.expiresAt) {
+		return ErrRefreshTokenRevoked
+	}
+	if f.current != tokenID {
+		return ErrRefreshTokenReused
+	}
+
+	return nil
+}
+
+// RevokeFamily revokes all tokens of the family.
+// The revoked family is kept until its last token expires.
+func (s *MemoryRefreshTokenStore) RevokeFamily(_ context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.families[family]; ok {
+		f.revoked = true
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package solauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	walletAddr := wallet.PublicKey.ToBase58()
+
+	var (
+		eventsMu sync.Mutex
+		events   []solauth.SecurityEvent
+	)
+	j := solauth.NewJWT(authSigningKey,
+		solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()),
+		solauth.WithSecurityEventHandler(func(_ context.Context, e solauth.SecurityEvent) {
+			eventsMu.Lock()
+			events = append(events, e)
+			eventsMu.Unlock()
+		}),
+	)
+
+	tokens, err := j.IssueTokens(ctx, walletAddr)
+	require.NoError(t, err)
+
+	claims, err := j.VerifyToken(tokens.Refresh)
+	require.NoError(t, err)
+	require.NotEmpty(t, claims.Family)
+
+	rotated, err := j.RefreshToken(ctx, tokens.Refresh)
+	require.NoError(t, err)
+
+	rotatedClaims, err := j.VerifyToken(rotated.Refresh)
+	require.NoError(t, err)
+	require.Equal(t, claims.Family, rotatedClaims.Family)
+
+	// The rotated token is presented again: the family is revoked
+	_, err = j.RefreshToken(ctx, tokens.Refresh)
+	require.ErrorIs(t, err, solauth.ErrRefreshTokenReused)
+	require.Len(t, events, 1)
+	require.Equal(t, solauth.SecurityEventRefreshTokenReuse, events[0].Type)
+	require.Equal(t, walletAddr, events[0].Wallet)
+	require.Equal(t, claims.Family, events[0].Family)
+	require.Equal(t, claims.ID, events[0].TokenID)
+
+	// The latest token of the family is revoked too
+	_, err = j.RefreshToken(ctx, rotated.Refresh)
+	require.ErrorIs(t, err, solauth.ErrRefreshTokenRevoked)
+
+	// Other families are not affected
+	other, err := j.IssueTokens(ctx, walletAddr)
+	require.NoError(t, err)
+	_, err = j.RefreshToken(ctx, other.Refresh)
+	require.NoError(t, err)
+
+	t.Run("untracked token", func(t *testing.T) {
+		legacy, err := solauth.NewJWT(authSigningKey).IssueTokens(ctx, walletAddr)
+		require.NoError(t, err)
+		_, err = j.RefreshToken(ctx, legacy.Refresh)
+		require.ErrorIs(t, err, solauth.ErrRefreshTokenRevoked)
+	})
+
+	t.Run("concurrent refresh", func(t *testing.T) {
+		tokens, err := j.IssueTokens(ctx, walletAddr)
+		require.NoError(t, err)
+
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			succeeded int
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := j.RefreshToken(ctx, tokens.Refresh); err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, 1, succeeded)
+	})
+
+	t.Run("reuse revokes access tokens", func(t *testing.T) {
+		var resolved int
+		j := solauth.NewJWT(authSigningKey,
+			solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()),
+			solauth.WithRevocationStore(solauth.NewMemoryRevocationStore()),
+			solauth.WithRoleResolver(solauth.RoleResolverFunc(func(context.Context, string) (solauth.Grant, error) {
+				resolved++
+				return solauth.Grant{}, nil
+			})),
+		)
+
+		tokens, err := j.IssueTokens(ctx, walletAddr)
+		require.NoError(t, err)
+		rotated, err := j.RefreshToken(ctx, tokens.Refresh)
+		require.NoError(t, err)
+		require.Equal(t, 2, resolved)
+
+		_, err = j.RefreshToken(ctx, tokens.Refresh)
+		require.ErrorIs(t, err, solauth.ErrRefreshTokenReused)
+		// no tokens are issued for the reused token
+		require.Equal(t, 2, resolved)
+
+		for _, access := range []string{tokens.Access, rotated.Access} {
+			_, err = j.VerifyAccessToken(access)
+			require.ErrorIs(t, err, solauth.ErrTokenRevoked)
+		}
+
+		// other families are not affected
+		other, err := j.IssueTokens(ctx, walletAddr)
+		require.NoError(t, err)
+		_, err = j.VerifyAccessToken(other.Access)
+		require.NoError(t, err)
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		tokens, err := j.IssueTokens(ctx, walletAddr)
+		require.NoError(t, err)
+		_, err = j.RefreshToken(ctx, tokens.Refresh)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(`{"refresh_token":"`+tokens.Refresh+`"}`))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		solauth.RefreshToken(j)(rr, req)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
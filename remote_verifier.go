@@ -0,0 +1,236 @@
+package solauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default settings of the RemoteVerifier.
+const (
+	DefaultJWKSCacheTTL       = time.Hour
+	DefaultJWKSRefreshLimit   = time.Minute
+	DefaultJWKSRequestTimeout = time.Second * 10
+)
+
+// RemoteVerifier verifies tokens with the public keys fetched from
+// the JWKS endpoint of the solauth server, so the services which only protect
+// routes don't need any signing material. It satisfies the same contract
+// as JWT.VerifyAccessToken and can be used with Middleware and GoKitMiddleware.
+// The fetched key set is cached and refreshed when it's expired or
+// when a token is signed with an unknown key, but not more often
+// than the refresh limit allows.
+type RemoteVerifier struct {
+	jwksURL      string
+	client       *http.Client
+	cacheTTL     time.Duration
+	refreshLimit time.Duration
+	validation   TokenValidation
+	timeout      time.Duration
+
+	mu          sync.RWMutex
+	keyring     *Keyring
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	inflight    *jwksFetch
+}
+
+// jwksFetch is the fetch of the key set in progress,
+// the concurrent lookups wait for it instead of fetching again.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// RemoteVerifierOption is the option for the RemoteVerifier.
+type RemoteVerifierOption func(*RemoteVerifier)
+
+// WithHTTPClient sets the HTTP client to fetch the key set with.
+func WithHTTPClient(c *http.Client) RemoteVerifierOption {
+	return func(v *RemoteVerifier) {
+		v.client = c
+	}
+}
+
+// WithJWKSCacheTTL sets how long the fetched key set is used before refetching.
+// Default is DefaultJWKSCacheTTL.
+func WithJWKSCacheTTL(ttl time.Duration) RemoteVerifierOption {
+	return func(v *RemoteVerifier) {
+		v.cacheTTL = ttl
+	}
+}
+
+// WithJWKSRefreshLimit sets the minimal interval between fetching attempts,
+// so tokens with random "kid" can't make the verifier flood the server.
+// Default is DefaultJWKSRefreshLimit.
+func WithJWKSRefreshLimit(d time.Duration) RemoteVerifierOption {
+	return func(v *RemoteVerifier) {
+		v.refreshLimit = d
+	}
+}
+
+// WithJWKSRequestTimeout sets the timeout of fetching the key set on lookup.
+// Default is DefaultJWKSRequestTimeout.
+func WithJWKSRequestTimeout(d time.Duration) RemoteVerifierOption {
+	return func(v *RemoteVerifier) {
+		v.timeout = d
+	}
+}
+
+// WithTokenValidation sets the claim checks applied to verified tokens,
+// it should match the issuer and audience configured on the server.
+func WithTokenValidation(tv TokenValidation) RemoteVerifierOption {
+	return func(v *RemoteVerifier) {
+		v.validation = tv
+	}
+}
+
+// NewRemoteVerifier creates a new verifier with the key set from the given URL,
+// e.g. https://auth.example.com/.well-known/jwks.json.
+// The key set is fetched lazily on the first verification.
+func NewRemoteVerifier(jwksURL string, opts ...RemoteVerifierOption) *RemoteVerifier {
+	v := &RemoteVerifier{
+		jwksURL:      jwksURL,
+		client:       &http.Client{Timeout: DefaultJWKSRequestTimeout},
+		cacheTTL:     DefaultJWKSCacheTTL,
+		refreshLimit: DefaultJWKSRefreshLimit,
+		timeout:      DefaultJWKSRequestTimeout,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// VerifyToken verifies the token.
+// This function verifies the token and returns the claims.
+func (v *RemoteVerifier) VerifyToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, v.validation, v.lookup)
+}
+
+// VerifyAccessToken verifies the token and checks it's an access token.
+func (v *RemoteVerifier) VerifyAccessToken(tokenString string) (*Claims, error) {
+	return verifyTokenType(v.VerifyToken, tokenString, TokenTypeAccess)
+}
+
+// Refresh fetches the key set from the server regardless of the cache state.
+func (v *RemoteVerifier) Refresh(ctx context.Context) error {
+	return v.refresh(ctx, true)
+}
+
+// lookup returns the key with the given ID. If there is no such key,
+// the key set is refetched once the refresh limit allows.
+// The lookups of the known keys don't wait for the fetch.
+func (v *RemoteVerifier) lookup(kid string) (Key, error) {
+	now := time.Now()
+
+	v.mu.RLock()
+	keyring, fresh := v.keyring, now.Sub(v.fetchedAt) < v.cacheTTL
+	v.mu.RUnlock()
+
+	if keyring != nil && fresh {
+		if key, err := keyring.VerificationKey(kid, now); err == nil {
+			return key, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+	if err := v.refresh(ctx, false); err != nil && keyring == nil {
+		return Key{}, err
+	}
+
+	v.mu.RLock()
+	keyring = v.keyring
+	v.mu.RUnlock()
+	if keyring == nil {
+		return Key{}, fmt.Errorf("key set is not fetched yet")
+	}
+
+	return keyring.VerificationKey(kid, now)
+}
+
+// refresh fetches the key set once at a time, the concurrent calls wait for
+// the fetch in progress. Unless force is set, the key set is not refetched
+// more often than the refresh limit allows.
+func (v *RemoteVerifier) refresh(ctx context.Context, force bool) error {
+	v.mu.Lock()
+	if f := v.inflight; f != nil {
+		v.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return fmt.Errorf("failed to fetch key set: %w", ctx.Err())
+		}
+	}
+	if !force && v.keyring != nil && time.Since(v.attemptedAt) < v.refreshLimit {
+		v.mu.Unlock()
+		return nil
+	}
+	f := &jwksFetch{done: make(chan struct{})}
+	v.inflight = f
+	v.attemptedAt = time.Now()
+	startedAt := v.attemptedAt
+	v.mu.Unlock()
+
+	keyring, err := v.fetch(ctx)
+
+	v.mu.Lock()
+	if err == nil {
+		v.keyring = keyring
+		v.fetchedAt = startedAt
+	}
+	v.inflight = nil
+	v.mu.Unlock()
+
+	f.err = err
+	close(f.done)
+
+	return err
+}
+
+// fetch fetches the key set.
+func (v *RemoteVerifier) fetch(ctx context.Context) (*Keyring, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key set: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key set: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch key set: unexpected status: %s", resp.Status)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode key set: %w", err)
+	}
+
+	keys := make([]Key, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Skip the keys of unsupported types, the server may publish them for other clients
+		if key, err := jwk.Key(); err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	keyring, err := NewKeyring(keys...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	return keyring, nil
+}
@@ -0,0 +1,153 @@
+package solauth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteVerifier(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	first, err := solauth.NewPrivateKey(edKey)
+	require.NoError(t, err)
+	first.ID = "first"
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	second, err := solauth.NewPrivateKey(ecKey)
+	require.NoError(t, err)
+	second.ID = "second"
+	second.ActivatesAt = time.Now().Add(time.Hour)
+
+	keyring, err := solauth.NewKeyring(first)
+	require.NoError(t, err)
+	issuer := solauth.NewJWTWithKeyring(keyring)
+
+	var hits int32
+	jwks := solauth.JWKSHandler(issuer)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		jwks(w, r)
+	}))
+	defer server.Close()
+
+	verifier := solauth.NewRemoteVerifier(server.URL, solauth.WithJWKSRefreshLimit(time.Millisecond*50))
+
+	tokens, err := issuer.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	claims, err := verifier.VerifyToken(tokens.Access)
+	require.NoError(t, err)
+	require.Equal(t, wallet.PublicKey.ToBase58(), claims.Wallet)
+
+	_, err = verifier.VerifyAccessToken(tokens.Access)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt32(&hits), "key set must be cached")
+
+	_, err = verifier.VerifyAccessToken(tokens.Refresh)
+	require.ErrorIs(t, err, solauth.ErrUnexpectedTokenType)
+
+	// Rotate the signing key
+	second.ActivatesAt = time.Now().Add(-time.Second)
+	keyring, err = solauth.NewKeyring(first, second)
+	require.NoError(t, err)
+	issuer.SetKeyring(keyring)
+
+	rotated, err := issuer.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	// Unknown key id within the refresh limit
+	_, err = verifier.VerifyToken(rotated.Access)
+	require.Error(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt32(&hits), "refresh must be rate limited")
+
+	// Unknown key id after the refresh limit
+	time.Sleep(time.Millisecond * 60)
+	_, err = verifier.VerifyToken(rotated.Access)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, atomic.LoadInt32(&hits))
+
+	t.Run("foreign token", func(t *testing.T) {
+		foreign, err := solauth.NewJWT(authSigningKey).IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+		require.NoError(t, err)
+
+		_, err = verifier.VerifyToken(foreign.Access)
+		require.Error(t, err)
+	})
+}
+
+func TestRemoteVerifierSlowServer(t *testing.T) {
+	newIssuer := func(kid string) *solauth.JWT {
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		key, err := solauth.NewPrivateKey(edKey)
+		require.NoError(t, err)
+		key.ID = kid
+		keyring, err := solauth.NewKeyring(key)
+		require.NoError(t, err)
+		return solauth.NewJWTWithKeyring(keyring)
+	}
+	issuer, unknown := newIssuer("known"), newIssuer("unknown")
+
+	var hits int32
+	release := make(chan struct{})
+	jwks := solauth.JWKSHandler(issuer)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first fetch succeeds, the next ones hang
+		if atomic.AddInt32(&hits, 1) > 1 {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		jwks(w, r)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	verifier := solauth.NewRemoteVerifier(server.URL,
+		solauth.WithJWKSRefreshLimit(0),
+		solauth.WithJWKSRequestTimeout(time.Millisecond*200),
+	)
+
+	known, err := issuer.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+	_, err = verifier.VerifyAccessToken(known.Access)
+	require.NoError(t, err)
+
+	foreign, err := unknown.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	errs := make(chan error, 5)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := verifier.VerifyAccessToken(foreign.Access)
+			errs <- err
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	// the known key is verified while the key set is being fetched
+	start := time.Now()
+	_, err = verifier.VerifyAccessToken(known.Access)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), time.Millisecond*100)
+
+	// the fetch is bounded and shared by the concurrent lookups
+	for i := 0; i < cap(errs); i++ {
+		require.Error(t, <-errs)
+	}
+	require.EqualValues(t, 2, atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,231 @@
+package solauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RevocationStore keeps the IDs ("jti" claim) of the revoked tokens
+// and the IDs ("fid" claim) of the revoked refresh token families.
+// A revoked ID is kept until the last token with it expires.
+type RevocationStore interface {
+	// Revoke revokes the token with the given ID until expiresAt.
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// IsRevoked reports whether the token with the given ID is revoked.
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+// MemoryRevocationStore is the in-memory implementation of RevocationStore.
+// It's suitable for a single instance deployment only.
+type MemoryRevocationStore struct {
+	mu    sync.RWMutex
+	items map[string]time.Time
+}
+
+// NewMemoryRevocationStore creates a new in-memory revocation store.
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		items: make(map[string]time.Time),
+	}
+}
+
+// Revoke revokes the token and drops all expired ones.
+func (s *MemoryRevocationStore) Revoke(_ context.Context, tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range s.items {
+		if !now.Before(exp) {
+			delete(s.items, id)
+		}
+	}
+
+	s.items[tokenID] = expiresAt
+	return nil
+}
+
+// IsRevoked reports whether the token is revoked.
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, tokenID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	exp, ok := s.items[tokenID]
+	return ok && time.Now().Before(exp), nil
+}
+
+// CachedRevocationStore caches the lookups of the underlying store in process,
+// so verifying tokens doesn't hit the shared storage on every request.
+// Tokens revoked through this instance are rejected immediately,
+// tokens revoked by other instances are rejected once the cached lookup expires.
+type CachedRevocationStore struct {
+	store RevocationStore
+	ttl   time.Duration
+
+	mu      sync.RWMutex
+	items   map[string]cachedRevocation
+	sweptAt time.Time
+}
+
+// cachedRevocation is the cached lookup result.
+type cachedRevocation struct {
+	revoked bool
+	until   time.Time
+}
+
+// NewCachedRevocationStore creates a new cache in front of the given store.
+// Lookup results are cached for ttl.
+func NewCachedRevocationStore(store RevocationStore, ttl time.Duration) *CachedRevocationStore {
+	return &CachedRevocationStore{
+		store:   store,
+		ttl:     ttl,
+		items:   make(map[string]cachedRevocation),
+		sweptAt: time.Now(),
+	}
+}
+
+// Revoke revokes the token in the underlying store and caches the result.
+func (s *CachedRevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if err := s.store.Revoke(ctx, tokenID, expiresAt); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(tokenID, cachedRevocation{revoked: true, until: expiresAt})
+
+	return nil
+}
+
+// IsRevoked returns the cached lookup result or asks the underlying store.
+func (s *CachedRevocationStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	now := time.Now()
+
+	s.mu.RLock()
+	item, ok := s.items[tokenID]
+	s.mu.RUnlock()
+	if ok && now.Before(item.until) {
+		return item.revoked, nil
+	}
+
+	revoked, err := s.store.IsRevoked(ctx, tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(tokenID, cachedRevocation{revoked: revoked, until: now.Add(s.ttl)})
+
+	return revoked, nil
+}
+
+// set caches the lookup result and drops the expired ones once per ttl.
+// The caller must hold the lock.
+func (s *CachedRevocationStore) set(tokenID string, item cachedRevocation) {
+	now := time.Now()
+	if now.Sub(s.sweptAt) >= s.ttl {
+		for id, it := range s.items {
+			if !now.Before(it.until) {
+				delete(s.items, id)
+			}
+		}
+		s.sweptAt = now
+	}
+	s.items[tokenID] = item
+}
+
+// LogoutPayload is the payload for the logout.
+type LogoutPayload struct {
+	// RefreshToken is the refresh token of the session, optional.
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// Logout is the handler to end the current session.
+// It must be mounted behind Middleware: it revokes the access token
+// from the request and all refresh tokens of the session.
+// The refresh token can be passed in the payload to revoke it
+// when refresh token rotation is disabled.
+func Logout(jwt interface {
+	RevokeSession(ctx context.Context, claims *Claims) error
+	RevokeToken(ctx context.Context, tokenString string) error
+},
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := GetClaimsFromRequest(r)
+		if claims == nil {
+			defaultResponse(w, http.StatusUnauthorized, map[string]interface{}{
+				"code":  http.StatusUnauthorized,
+				"error": ErrUnauthorized.Error(),
+			})
+			return
+		}
+
+		// Parse JSON request, the body is optional
+		var payload LogoutPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if err := jwt.RevokeSession(r.Context(), claims); err != nil {
+			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"code":  http.StatusInternalServerError,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if payload.RefreshToken != "" {
+			err := jwt.RevokeToken(r.Context(), payload.RefreshToken)
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+					"code":  http.StatusInternalServerError,
+					"error": err.Error(),
+				})
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Revoke is the token revocation endpoint (RFC 7009).
+// It accepts the form encoded "token" parameter, the optional "token_type_hint"
+// is ignored since both token types are revoked the same way.
+// Invalid and already expired tokens are ignored, as the specification requires,
+// so the response doesn't disclose whether the token was valid.
+func Revoke(jwt interface {
+	RevokeToken(ctx context.Context, tokenString string) error
+},
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.PostFormValue("token")
+		if token == "" {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"error":             "invalid_request",
+				"error_description": "token is required",
+			})
+			return
+		}
+
+		if err := jwt.RevokeToken(r.Context(), token); err != nil && !errors.Is(err, ErrInvalidToken) {
+			defaultResponse(w, http.StatusServiceUnavailable, map[string]interface{}{
+				"error":             "temporarily_unavailable",
+				"error_description": err.Error(),
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,200 @@
+package solauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokeToken(t *testing.T) {
+	ctx := context.Background()
+	j := solauth.NewJWT(authSigningKey,
+		solauth.WithRevocationStore(solauth.NewMemoryRevocationStore()),
+		solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()),
+	)
+
+	tokens, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	_, err = j.VerifyToken(tokens.Access)
+	require.NoError(t, err)
+
+	require.NoError(t, j.RevokeToken(ctx, tokens.Access))
+	_, err = j.VerifyToken(tokens.Access)
+	require.ErrorIs(t, err, solauth.ErrTokenRevoked)
+
+	// The refresh token is still valid
+	rotated, err := j.RefreshToken(ctx, tokens.Refresh)
+	require.NoError(t, err)
+
+	// Revoking the refresh token revokes its family
+	require.NoError(t, j.RevokeToken(ctx, rotated.Refresh))
+	_, err = j.RefreshToken(ctx, rotated.Refresh)
+	require.ErrorIs(t, err, solauth.ErrTokenRevoked)
+
+	err = j.RevokeToken(ctx, "invalid")
+	require.ErrorIs(t, err, solauth.ErrInvalidToken)
+
+	t.Run("without revocation store", func(t *testing.T) {
+		j := solauth.NewJWT(authSigningKey, solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()))
+
+		tokens, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+		require.NoError(t, err)
+
+		// the tokens themselves can't be revoked, but the family is
+		require.NoError(t, j.RevokeToken(ctx, tokens.Access))
+		require.NoError(t, j.RevokeToken(ctx, tokens.Refresh))
+		_, err = j.RefreshToken(ctx, tokens.Refresh)
+		require.ErrorIs(t, err, solauth.ErrRefreshTokenRevoked)
+
+		require.NoError(t, solauth.NewJWT(authSigningKey).RevokeToken(ctx, tokens.Access))
+	})
+}
+
+func TestRevokeTokenWithLeeway(t *testing.T) {
+	ctx := context.Background()
+	j := solauth.NewJWT(authSigningKey,
+		solauth.WithRevocationStore(solauth.NewMemoryRevocationStore()),
+		solauth.WithAccessTTL(-time.Minute),
+		solauth.WithLeeway(time.Hour),
+	)
+
+	tokens, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	// the expired token is accepted within the leeway
+	_, err = j.VerifyToken(tokens.Access)
+	require.NoError(t, err)
+
+	require.NoError(t, j.RevokeToken(ctx, tokens.Access))
+	_, err = j.VerifyToken(tokens.Access)
+	require.ErrorIs(t, err, solauth.ErrTokenRevoked)
+}
+
+func TestCachedRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	shared := solauth.NewMemoryRevocationStore()
+	cached := solauth.NewCachedRevocationStore(shared, time.Hour)
+
+	revoked, err := cached.IsRevoked(ctx, "token")
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	// Revoked by another instance: the cached lookup is used until it expires
+	require.NoError(t, shared.Revoke(ctx, "token", time.Now().Add(time.Hour)))
+	revoked, err = cached.IsRevoked(ctx, "token")
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	// Revoked through the cache: rejected immediately
+	require.NoError(t, cached.Revoke(ctx, "other", time.Now().Add(time.Hour)))
+	revoked, err = cached.IsRevoked(ctx, "other")
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	revoked, err = shared.IsRevoked(ctx, "other")
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	nocache := solauth.NewCachedRevocationStore(shared, 0)
+	revoked, err = nocache.IsRevoked(ctx, "token")
+	require.NoError(t, err)
+	require.True(t, revoked)
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	j := solauth.NewJWT(authSigningKey,
+		solauth.WithRevocationStore(solauth.NewMemoryRevocationStore()),
+		solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()),
+	)
+	handler := solauth.Middleware(j)(solauth.Logout(j))
+
+	tokens, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", tokens.Access)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	_, err = j.VerifyToken(tokens.Access)
+	require.ErrorIs(t, err, solauth.ErrTokenRevoked)
+	_, err = j.RefreshToken(ctx, tokens.Refresh)
+	require.ErrorIs(t, err, solauth.ErrTokenRevoked)
+
+	// The revoked access token can't be used anymore
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	t.Run("empty chunked body", func(t *testing.T) {
+		tokens, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout", strings.NewReader(""))
+		req.ContentLength = -1
+		req.Header.Set("Authorization", tokens.Access)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusNoContent, rr.Code)
+
+		// the malformed body is still rejected
+		other, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+		require.NoError(t, err)
+		req = httptest.NewRequest(http.MethodPost, "/auth/logout", strings.NewReader("{"))
+		req.ContentLength = -1
+		req.Header.Set("Authorization", other.Access)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("without revocation store", func(t *testing.T) {
+		j := solauth.NewJWT(authSigningKey, solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()))
+
+		tokens, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.Header.Set("Authorization", tokens.Access)
+		rr := httptest.NewRecorder()
+		solauth.Middleware(j)(solauth.Logout(j)).ServeHTTP(rr, req)
+		require.Equal(t, http.StatusNoContent, rr.Code)
+
+		_, err = j.RefreshToken(ctx, tokens.Refresh)
+		require.ErrorIs(t, err, solauth.ErrRefreshTokenRevoked)
+	})
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+	j := solauth.NewJWT(authSigningKey, solauth.WithRevocationStore(solauth.NewMemoryRevocationStore()))
+
+	tokens, err := j.IssueTokens(ctx, wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	revoke := func(form url.Values) int {
+		req := httptest.NewRequest(http.MethodPost, "/auth/revoke", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		solauth.Revoke(j)(rr, req)
+		return rr.Code
+	}
+
+	require.Equal(t, http.StatusOK, revoke(url.Values{"token": {tokens.Refresh}, "token_type_hint": {"refresh_token"}}))
+	_, err = j.RefreshToken(ctx, tokens.Refresh)
+	require.ErrorIs(t, err, solauth.ErrTokenRevoked)
+
+	// Invalid tokens don't cause an error response
+	require.Equal(t, http.StatusOK, revoke(url.Values{"token": {"invalid"}}))
+	require.Equal(t, http.StatusBadRequest, revoke(url.Values{}))
+}
@@ -0,0 +1,269 @@
+package solauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Grant is the set of scopes and roles granted to the wallet.
+type Grant struct {
+	Scopes []string `json:"scopes,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+// merge returns the grant with the scopes and roles of both grants.
+func (g Grant) merge(other Grant) Grant {
+	return Grant{
+		Scopes: appendUnique(g.Scopes, other.Scopes...),
+		Roles:  appendUnique(g.Roles, other.Roles...),
+	}
+}
+
+// RoleResolver decides what scopes and roles the wallet gets.
+// It's consulted on every token issue and refresh,
+// so the changes are applied with the next refresh.
+type RoleResolver interface {
+	Resolve(ctx context.Context, walletAddr string) (Grant, error)
+}
+
+// RoleResolverFunc is the function adapter for RoleResolver.
+type RoleResolverFunc func(ctx context.Context, walletAddr string) (Grant, error)
+
+// Resolve calls f(ctx, walletAddr).
+func (f RoleResolverFunc) Resolve(ctx context.Context, walletAddr string) (Grant, error) {
+	return f(ctx, walletAddr)
+}
+
+// StaticRoleResolver resolves grants from the static mapping, e.g.:
+//
+//	{
+//		"default": {"scopes": ["profile:read"]},
+//		"wallets": {
+//			"8ZbN5Ug3Tt1a...": {"roles": ["admin"]}
+//		},
+//		"roles": {
+//			"admin": ["profile:read", "profile:write", "users:manage"]
+//		}
+//	}
+//
+// Every wallet gets the default grant and its own grant,
+// and every role adds the scopes listed for it.
+type StaticRoleResolver struct {
+	// Default is granted to every wallet.
+	Default Grant `json:"default"`
+	// Wallets is the grants of the particular wallets.
+	Wallets map[string]Grant `json:"wallets"`
+	// Roles is the scopes granted with the role.
+	Roles map[string][]string `json:"roles"`
+}
+
+// LoadStaticRoleResolver loads the static mapping from the JSON file.
+func LoadStaticRoleResolver(path string) (*StaticRoleResolver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+
+	var r StaticRoleResolver
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse roles: %w", err)
+	}
+
+	return &r, nil
+}
+
+// Resolve returns the grant of the wallet.
+func (r *StaticRoleResolver) Resolve(_ context.Context, walletAddr string) (Grant, error) {
+	g := Grant{}.merge(r.Default).merge(r.Wallets[walletAddr])
+	for _, role := range g.Roles {
+		g.Scopes = appendUnique(g.Scopes, r.Roles[role]...)
+	}
+	return g, nil
+}
+
+// HasScopes reports whether the claims have all the given scopes.
+func (c *Claims) HasScopes(scopes ...string) bool {
+	return containsAll(c.Scopes, scopes)
+}
+
+// HasRoles reports whether the claims have all the given roles.
+func (c *Claims) HasRoles(roles ...string) bool {
+	return containsAll(c.Roles, roles)
+}
+
+// AccessDeniedError is the error of the request which claims
+// don't satisfy the authorization requirement.
+// It implements the go-kit StatusCoder, Headerer and json.Marshaler interfaces,
+// so the go-kit default error encoder renders it as 403 with the structured body.
+type AccessDeniedError struct {
+	// Err is ErrInsufficientScope or ErrInsufficientRole.
+	Err error
+	// Required is the list of the required scopes or roles.
+	Required []string
+}
+
+// Error returns the error message.
+func (e *AccessDeniedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *AccessDeniedError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code of the error.
+func (e *AccessDeniedError) StatusCode() int {
+	return http.StatusForbidden
+}
+
+// Headers returns the WWW-Authenticate header with the "insufficient_scope" error (RFC 6750).
+func (e *AccessDeniedError) Headers() http.Header {
+	value := `Bearer error="insufficient_scope"`
+	if errors.Is(e.Err, ErrInsufficientScope) {
+		value += fmt.Sprintf(", scope=%q", strings.Join(e.Required, " "))
+	}
+	h := http.Header{}
+	h.Set("WWW-Authenticate", value)
+	return h
+}
+
+// MarshalJSON returns the JSON error envelope with the requirement.
+func (e *AccessDeniedError) MarshalJSON() ([]byte, error) {
+	body := map[string]interface{}{
+		"code":  http.StatusForbidden,
+		"error": e.Err.Error(),
+	}
+	if errors.Is(e.Err, ErrInsufficientScope) {
+		body["required_scopes"] = e.Required
+	} else {
+		body["required_roles"] = e.Required
+	}
+	return json.Marshal(body)
+}
+
+// RequireScopes is the middleware which allows the request only if
+// the claims added by Middleware have all the given scopes.
+// It responds with 403 and the structured body otherwise.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return requireClaims(func(c *Claims) error {
+		if !c.HasScopes(scopes...) {
+			return &AccessDeniedError{Err: ErrInsufficientScope, Required: scopes}
+		}
+		return nil
+	})
+}
+
+// RequireRoles is the middleware which allows the request only if
+// the claims added by Middleware have all the given roles.
+// It responds with 403 and the structured body otherwise.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return requireClaims(func(c *Claims) error {
+		if !c.HasRoles(roles...) {
+			return &AccessDeniedError{Err: ErrInsufficientRole, Required: roles}
+		}
+		return nil
+	})
+}
+
+// requireClaims is the middleware which checks the claims from the request context.
+func requireClaims(check func(*Claims) error) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetClaimsFromRequest(r)
+			if claims == nil {
+				JSONErrorHandler(w, r, ErrUnauthorized)
+				return
+			}
+
+			if err := check(claims); err != nil {
+				var denied *AccessDeniedError
+				if errors.As(err, &denied) {
+					for k, values := range denied.Headers() {
+						for _, v := range values {
+							w.Header().Add(k, v)
+						}
+					}
+				}
+				defaultResponse(w, http.StatusForbidden, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GoKitRequireScopes is the go-kit middleware which allows the request only if
+// the claims added by GoKitMiddleware have all the given scopes.
+// It returns AccessDeniedError otherwise.
+func GoKitRequireScopes(scopes ...string) endpoint.Middleware {
+	return goKitRequireClaims(func(c *Claims) error {
+		if !c.HasScopes(scopes...) {
+			return &AccessDeniedError{Err: ErrInsufficientScope, Required: scopes}
+		}
+		return nil
+	})
+}
+
+// GoKitRequireRoles is the go-kit middleware which allows the request only if
+// the claims added by GoKitMiddleware have all the given roles.
+// It returns AccessDeniedError otherwise.
+func GoKitRequireRoles(roles ...string) endpoint.Middleware {
+	return goKitRequireClaims(func(c *Claims) error {
+		if !c.HasRoles(roles...) {
+			return &AccessDeniedError{Err: ErrInsufficientRole, Required: roles}
+		}
+		return nil
+	})
+}
+
+// goKitRequireClaims is the go-kit middleware which checks the claims from the context.
+func goKitRequireClaims(check func(*Claims) error) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			claims := GetClaimsFromContext(ctx)
+			if claims == nil {
+				return nil, ErrUnauthorized
+			}
+			if err := check(claims); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// containsAll reports whether the list contains all the values.
+func containsAll(list, values []string) bool {
+	for _, v := range values {
+		found := false
+		for _, item := range list {
+			if item == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// appendUnique appends the values missing in the list.
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !containsAll(list, []string{v}) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,130 @@
+package solauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticRoleResolver(t *testing.T) {
+	walletAddr := wallet.PublicKey.ToBase58()
+	path := filepath.Join(t.TempDir(), "roles.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"default": {"scopes": ["profile:read"]},
+		"wallets": {"`+walletAddr+`": {"roles": ["admin"]}},
+		"roles": {"admin": ["profile:read", "users:manage"]}
+	}`), 0o600))
+
+	resolver, err := solauth.LoadStaticRoleResolver(path)
+	require.NoError(t, err)
+
+	grant, err := resolver.Resolve(context.Background(), walletAddr)
+	require.NoError(t, err)
+	require.Equal(t, []string{"profile:read", "users:manage"}, grant.Scopes)
+	require.Equal(t, []string{"admin"}, grant.Roles)
+
+	grant, err = resolver.Resolve(context.Background(), "another-wallet")
+	require.NoError(t, err)
+	require.Equal(t, []string{"profile:read"}, grant.Scopes)
+	require.Empty(t, grant.Roles)
+
+	j := solauth.NewJWT(authSigningKey, solauth.WithRoleResolver(resolver))
+	tokens, err := j.IssueTokens(context.Background(), walletAddr)
+	require.NoError(t, err)
+
+	claims, err := j.VerifyAccessToken(tokens.Access)
+	require.NoError(t, err)
+	require.Equal(t, []string{"profile:read", "users:manage"}, claims.Scopes)
+	require.Equal(t, []string{"admin"}, claims.Roles)
+	require.True(t, claims.HasScopes("users:manage"))
+	require.True(t, claims.HasRoles("admin"))
+	require.False(t, claims.HasRoles("admin", "owner"))
+
+	// Roles are resolved again on refresh
+	resolver.Wallets = nil
+	tokens, err = j.RefreshToken(context.Background(), tokens.Refresh)
+	require.NoError(t, err)
+	claims, err = j.VerifyAccessToken(tokens.Access)
+	require.NoError(t, err)
+	require.Empty(t, claims.Roles)
+
+	_, err = solauth.LoadStaticRoleResolver(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
+
+func TestRequireScopes(t *testing.T) {
+	resolver := solauth.RoleResolverFunc(func(ctx context.Context, walletAddr string) (solauth.Grant, error) {
+		return solauth.Grant{Scopes: []string{"read"}, Roles: []string{"member"}}, nil
+	})
+	j := solauth.NewJWT(authSigningKey, solauth.WithRoleResolver(resolver))
+	tokens, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(mw func(http.Handler) http.Handler, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		solauth.Middleware(j, solauth.WithOptionalAuth())(mw(ok)).ServeHTTP(rr, req)
+		return rr
+	}
+
+	require.Equal(t, http.StatusOK, serve(solauth.RequireScopes("read"), tokens.Access).Code)
+	require.Equal(t, http.StatusOK, serve(solauth.RequireRoles("member"), tokens.Access).Code)
+	require.Equal(t, http.StatusUnauthorized, serve(solauth.RequireScopes("read"), "").Code)
+
+	rr := serve(solauth.RequireScopes("read", "write"), tokens.Access)
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Equal(t, `Bearer error="insufficient_scope", scope="read write"`, rr.Header().Get("WWW-Authenticate"))
+
+	var resp map[string]interface{}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.EqualValues(t, http.StatusForbidden, resp["code"])
+	require.Equal(t, solauth.ErrInsufficientScope.Error(), resp["error"])
+	require.Equal(t, []interface{}{"read", "write"}, resp["required_scopes"])
+
+	rr = serve(solauth.RequireRoles("admin"), tokens.Access)
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	resp = nil
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Equal(t, []interface{}{"admin"}, resp["required_roles"])
+}
+
+func TestGoKitRequireScopes(t *testing.T) {
+	resolver := solauth.RoleResolverFunc(func(ctx context.Context, walletAddr string) (solauth.Grant, error) {
+		return solauth.Grant{Scopes: []string{"read"}}, nil
+	})
+	j := solauth.NewJWT(authSigningKey, solauth.WithRoleResolver(resolver))
+	tokens, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), kitjwt.JWTContextKey, tokens.Access)
+	nop := func(ctx context.Context, request interface{}) (interface{}, error) { return "ok", nil }
+
+	resp, err := solauth.GoKitMiddleware(j)(solauth.GoKitRequireScopes("read")(nop))(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp)
+
+	_, err = solauth.GoKitMiddleware(j)(solauth.GoKitRequireScopes("write")(nop))(ctx, nil)
+	require.ErrorIs(t, err, solauth.ErrInsufficientScope)
+
+	_, err = solauth.GoKitMiddleware(j)(solauth.GoKitRequireRoles("admin")(nop))(ctx, nil)
+	require.ErrorIs(t, err, solauth.ErrInsufficientRole)
+
+	// The go-kit default error encoder renders the error as 403 with the structured body
+	rr := httptest.NewRecorder()
+	kithttp.DefaultErrorEncoder(ctx, err, rr)
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.JSONEq(t, `{"code":403,"error":"Insufficient role","required_roles":["admin"]}`, rr.Body.String())
+}
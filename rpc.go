@@ -0,0 +1,101 @@
+package solauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRPCRequestTimeout is the timeout of the RPC requests of the default HTTP client.
+const DefaultRPCRequestTimeout = time.Second * 10
+
+// RPCClient calls the methods of the Solana JSON-RPC API
+// and of its extensions, e.g. the Digital Asset Standard (DAS) API.
+type RPCClient interface {
+	// Call calls the method with the given params and decodes the result to the result value.
+	Call(ctx context.Context, method string, params interface{}, result interface{}) error
+}
+
+// RPCError is the error returned by the RPC server.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error returns the error message.
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// JSONRPCClient is the RPCClient over HTTP.
+type JSONRPCClient struct {
+	endpoint string
+	client   *http.Client
+	id       atomic.Uint64
+}
+
+// NewJSONRPCClient creates a new client of the RPC endpoint,
+// e.g. https://api.mainnet-beta.solana.com.
+// If client is nil, the HTTP client with DefaultRPCRequestTimeout is used.
+func NewJSONRPCClient(endpoint string, client *http.Client) *JSONRPCClient {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultRPCRequestTimeout}
+	}
+	return &JSONRPCClient{
+		endpoint: endpoint,
+		client:   client,
+	}
+}
+
+// Call calls the method with the given params and decodes the result to the result value.
+func (c *JSONRPCClient) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.id.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to call %s: unexpected status: %s", method, resp.Status)
+	}
+
+	var payload struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if payload.Error != nil {
+		return fmt.Errorf("failed to call %s: %w", method, payload.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(payload.Result, result); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", method, err)
+	}
+
+	return nil
+}
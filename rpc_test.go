@@ -0,0 +1,90 @@
+package solauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRPC is the local stand-in of the Solana RPC server
+// which responds with canned results of the registered methods.
+type fakeRPC struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	methods map[string]func(params json.RawMessage) (interface{}, *solauth.RPCError)
+	calls   map[string]int
+}
+
+func newFakeRPC(t *testing.T) *fakeRPC {
+	f := &fakeRPC{
+		methods: make(map[string]func(params json.RawMessage) (interface{}, *solauth.RPCError)),
+		calls:   make(map[string]int),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		f.mu.Lock()
+		handler, ok := f.methods[req.Method]
+		f.calls[req.Method]++
+		f.mu.Unlock()
+
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if !ok {
+			resp["error"] = solauth.RPCError{Code: -32601, Message: "Method not found"}
+		} else if result, rpcErr := handler(req.Params); rpcErr != nil {
+			resp["error"] = rpcErr
+		} else {
+			resp["result"] = result
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// handle registers the method handler.
+func (f *fakeRPC) handle(method string, h func(params json.RawMessage) (interface{}, *solauth.RPCError)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.methods[method] = h
+}
+
+// callsOf returns the number of calls of the method.
+func (f *fakeRPC) callsOf(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+func TestJSONRPCClient(t *testing.T) {
+	rpc := newFakeRPC(t)
+	rpc.handle("getSlot", func(params json.RawMessage) (interface{}, *solauth.RPCError) {
+		return 42, nil
+	})
+	rpc.handle("getBalance", func(params json.RawMessage) (interface{}, *solauth.RPCError) {
+		return nil, &solauth.RPCError{Code: -32602, Message: "Invalid param"}
+	})
+
+	client := solauth.NewJSONRPCClient(rpc.URL, nil)
+
+	var slot uint64
+	require.NoError(t, client.Call(context.Background(), "getSlot", []interface{}{}, &slot))
+	require.EqualValues(t, 42, slot)
+
+	err := client.Call(context.Background(), "getBalance", []interface{}{"wallet"}, nil)
+	var rpcErr *solauth.RPCError
+	require.ErrorAs(t, err, &rpcErr)
+	require.Equal(t, -32602, rpcErr.Code)
+}
@@ -0,0 +1,351 @@
+package solauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mr-tron/base58"
+)
+
+// DefaultMaxDelegationTTL is the default max lifetime of the session key delegation.
+const DefaultMaxDelegationTTL = time.Hour * 24
+
+// delegationClockSkew is the allowed difference of the client and server clocks
+// for the issued at time of the delegation.
+const delegationClockSkew = time.Minute
+
+const delegationHeaderSuffix = " wants you to authorize a session key for your Solana account:"
+
+// SessionKeyDelegation is the message signed by the main wallet to authorize
+// the ephemeral ed25519 session key, e.g.:
+//
+//	example.com wants you to authorize a session key for your Solana account:
+//	8ZbN5Ug3Tt1a...
+//
+//	Session Key: 3vQB7B6MrGQZ...
+//	Scopes: game:play game:trade
+//	Issued At: 2023-05-01T12:00:00Z
+//	Expiration Time: 2023-05-01T20:00:00Z
+//
+// The session key can sign in for the wallet until the delegation expires,
+// the wallet popup is shown once per delegation.
+type SessionKeyDelegation struct {
+	// Domain is the domain of the service the session key is authorized for.
+	Domain string
+	// Wallet is the base58 encoded address of the main wallet.
+	Wallet string
+	// SessionKey is the base58 encoded public key of the session key.
+	SessionKey string
+	// Scopes is the list of the scopes delegated to the session key,
+	// the session key gets no scopes if it's empty.
+	Scopes []string
+	// IssuedAt is the time the delegation was created at.
+	IssuedAt time.Time
+	// ExpiresAt is the time the delegation is no longer valid after.
+	ExpiresAt time.Time
+}
+
+// String returns the text of the delegation message to sign.
+func (d SessionKeyDelegation) String() string {
+	var sb strings.Builder
+	sb.WriteString(d.Domain + delegationHeaderSuffix + "\n")
+	sb.WriteString(d.Wallet + "\n\n")
+	sb.WriteString("Session Key: " + d.SessionKey + "\n")
+	if len(d.Scopes) > 0 {
+		sb.WriteString("Scopes: " + strings.Join(d.Scopes, " ") + "\n")
+	}
+	sb.WriteString("Issued At: " + formatSIWSTime(d.IssuedAt) + "\n")
+	sb.WriteString("Expiration Time: " + formatSIWSTime(d.ExpiresAt))
+	return sb.String()
+}
+
+// Validate checks the delegation fields.
+func (d SessionKeyDelegation) Validate() error {
+	if d.Domain == "" || strings.ContainsAny(d.Domain, " \n/") {
+		return fmt.Errorf("invalid domain: %q", d.Domain)
+	}
+	if b, err := base58.Decode(d.Wallet); err != nil || len(b) != 32 {
+		return fmt.Errorf("invalid wallet: %q", d.Wallet)
+	}
+	if b, err := base58.Decode(d.SessionKey); err != nil || len(b) != 32 {
+		return fmt.Errorf("invalid session key: %q", d.SessionKey)
+	}
+	if d.SessionKey == d.Wallet {
+		return fmt.Errorf("session key must differ from the wallet")
+	}
+	for _, s := range d.Scopes {
+		if s == "" || strings.ContainsAny(s, " \n") {
+			return fmt.Errorf("invalid scope: %q", s)
+		}
+	}
+	if d.IssuedAt.IsZero() || d.ExpiresAt.IsZero() {
+		return fmt.Errorf("issued at and expiration time are required")
+	}
+	if !d.ExpiresAt.After(d.IssuedAt) {
+		return fmt.Errorf("expiration time must be after issued at")
+	}
+	return nil
+}
+
+// ParseSessionKeyDelegation parses the text of the delegation message.
+// The parser is strict: the message must be exactly as formatted by String.
+func ParseSessionKeyDelegation(message string) (SessionKeyDelegation, error) {
+	var d SessionKeyDelegation
+
+	lines := strings.Split(message, "\n")
+	if len(lines) < 6 || !strings.HasSuffix(lines[0], delegationHeaderSuffix) || lines[2] != "" {
+		return SessionKeyDelegation{}, fmt.Errorf("%w: malformed message", ErrInvalidDelegation)
+	}
+	d.Domain = strings.TrimSuffix(lines[0], delegationHeaderSuffix)
+	d.Wallet = lines[1]
+
+	for _, line := range lines[3:] {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return SessionKeyDelegation{}, fmt.Errorf("%w: malformed field: %q", ErrInvalidDelegation, line)
+		}
+
+		var err error
+		switch key {
+		case "Session Key":
+			d.SessionKey = value
+		case "Scopes":
+			d.Scopes = strings.Split(value, " ")
+		case "Issued At":
+			d.IssuedAt, err = parseSIWSTime(value)
+		case "Expiration Time":
+			d.ExpiresAt, err = parseSIWSTime(value)
+		default:
+			err = fmt.Errorf("unknown field")
+		}
+		if err != nil {
+			return SessionKeyDelegation{}, fmt.Errorf("%w: invalid %s: %v", ErrInvalidDelegation, key, err)
+		}
+	}
+
+	if err := d.Validate(); err != nil {
+		return SessionKeyDelegation{}, fmt.Errorf("%w: %v", ErrInvalidDelegation, err)
+	}
+	if d.String() != message {
+		return SessionKeyDelegation{}, fmt.Errorf("%w: non-canonical message", ErrInvalidDelegation)
+	}
+
+	return d, nil
+}
+
+// sessionContextKey is the key for the session key delegation in the context.
+var sessionContextKey = &contextKey{name: "session-key"}
+
+// sessionDelegation is the session key delegation applied to the issued tokens.
+type sessionDelegation struct {
+	key       string
+	scopes    []string
+	expiresAt time.Time
+}
+
+// withSessionDelegation returns the context with the session key delegation,
+// IssueTokens limits the issued tokens to it.
+func withSessionDelegation(ctx context.Context, d sessionDelegation) context.Context {
+	return context.WithValue(ctx, sessionContextKey, d)
+}
+
+// sessionDelegationFromContext returns the session key delegation from the context.
+func sessionDelegationFromContext(ctx context.Context) (sessionDelegation, bool) {
+	d, ok := ctx.Value(sessionContextKey).(sessionDelegation)
+	return d, ok
+}
+
+// limitTTL returns the ttl limited to the delegation lifetime.
+func (d sessionDelegation) limitTTL(now time.Time, ttl time.Duration) time.Duration {
+	if left := d.expiresAt.Sub(now); left < ttl {
+		return left
+	}
+	return ttl
+}
+
+// limitScopes returns the scopes which are delegated to the session key.
+func (d sessionDelegation) limitScopes(scopes []string) []string {
+	var limited []string
+	for _, s := range scopes {
+		if containsAll(d.scopes, []string{s}) {
+			limited = append(limited, s)
+		}
+	}
+	return limited
+}
+
+// VerifySessionKeyPayload is the payload for the session key verification.
+type VerifySessionKeyPayload struct {
+	// Delegation is the SessionKeyDelegation message.
+	Delegation string `json:"delegation"`
+	// DelegationSignature is the signature of the delegation by the main wallet.
+	DelegationSignature string `json:"delegation_signature"`
+	// Message is the challenge issued by RequestAuth for the main wallet.
+	Message string `json:"message"`
+	// Signature is the signature of the challenge by the session key.
+	Signature string `json:"signature"`
+}
+
+// Validate validates the payload.
+func (p *VerifySessionKeyPayload) Validate() error {
+	if p.Delegation == "" {
+		return fmt.Errorf("delegation is required")
+	}
+	if p.DelegationSignature == "" {
+		return fmt.Errorf("delegation_signature is required")
+	}
+	if p.Message == "" {
+		return fmt.Errorf("message is required")
+	}
+	if p.Signature == "" {
+		return fmt.Errorf("signature is required")
+	}
+	return nil
+}
+
+// VerifySessionKey is the handler for the session keys delegated by the main wallet.
+// The delegation must be signed by the wallet for the given domain,
+// and the challenge issued by RequestAuth for the wallet must be signed by the session key.
+// The same signed delegation is sent with every challenge until it expires,
+// so only the session key signs on re-authentication.
+// It returns tokens of the main wallet with the session key in the "sk" claim.
+// The tokens expire with the delegation, and the delegation scopes
+// limit the scopes granted to the wallet, roles are not granted.
+// The delegation itself can't be revoked before it expires: the signed delegation
+// is accepted with any new challenge until then. Only the issued tokens can be revoked,
+// e.g. by Logout with the session key's access token, which revokes its token family.
+func VerifySessionKey(challenger interface {
+	VerifyChallenge(ctx context.Context, publicKey, message string) error
+}, jwt interface {
+	IssueTokens(ctx context.Context, walletAddr string) (TokenResponse, error)
+}, domain string, opts ...HandlerOption,
+) http.HandlerFunc {
+	o := newHandlerOptions(opts...)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse JSON request
+		var payload VerifySessionKeyPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Validate the payload
+		if err := payload.Validate(); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Verify the delegation
+		d, err := o.verifyDelegation(payload.Delegation, payload.DelegationSignature, domain)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, ErrInvalidDelegation) {
+				status = http.StatusBadRequest
+			}
+			defaultResponse(w, status, map[string]interface{}{
+				"code":  status,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Verify the challenge signature of the session key
+		sessionKey, _ := base58.Decode(d.SessionKey)
+		signature, err := DecodeSignature(payload.Signature, EncodingAuto)
+		if err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+		if _, err := VerifyMessageSignature(payload.Message, signature, sessionKey); err != nil {
+			defaultResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"code":  http.StatusBadRequest,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Consume the challenge
+		if err := challenger.VerifyChallenge(r.Context(), d.Wallet, payload.Message); err != nil {
+			defaultResponse(w, http.StatusUnauthorized, map[string]interface{}{
+				"code":  http.StatusUnauthorized,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		// Check the wallet policy and the access requirements
+		ctx, ok := o.checkAccess(w, r, d.Wallet)
+		if !ok {
+			return
+		}
+
+		// Issue tokens
+		tokens, err := jwt.IssueTokens(withSessionDelegation(ctx, sessionDelegation{
+			key:       d.SessionKey,
+			scopes:    d.Scopes,
+			expiresAt: d.ExpiresAt,
+		}), d.Wallet)
+		if err != nil {
+			defaultResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"code":  http.StatusInternalServerError,
+				"error": err.Error(),
+			})
+			return
+		}
+
+		defaultResponse(w, http.StatusOK, tokens)
+	}
+}
+
+// WithMaxDelegationTTL sets the max lifetime of the session key delegation,
+// default is DefaultMaxDelegationTTL.
+func WithMaxDelegationTTL(ttl time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.maxDelegationTTL = ttl
+	}
+}
+
+// verifyDelegation parses the delegation and verifies the signature of the main wallet.
+func (o handlerOptions) verifyDelegation(message, signature, domain string) (SessionKeyDelegation, error) {
+	d, err := ParseSessionKeyDelegation(message)
+	if err != nil {
+		return SessionKeyDelegation{}, err
+	}
+	if d.Domain != domain {
+		return SessionKeyDelegation{}, fmt.Errorf("%w: domain mismatch", ErrInvalidDelegation)
+	}
+	if d.ExpiresAt.Sub(d.IssuedAt) > o.maxDelegationTTL {
+		return SessionKeyDelegation{}, fmt.Errorf("%w: lifetime exceeds %s", ErrInvalidDelegation, o.maxDelegationTTL)
+	}
+
+	now := time.Now()
+	if d.IssuedAt.After(now.Add(delegationClockSkew)) || !now.Before(d.ExpiresAt) {
+		return SessionKeyDelegation{}, ErrDelegationExpired
+	}
+
+	wallet, _ := base58.Decode(d.Wallet)
+	sig, err := DecodeSignature(signature, EncodingAuto)
+	if err != nil {
+		return SessionKeyDelegation{}, fmt.Errorf("%w: %v", ErrInvalidDelegation, err)
+	}
+	if _, err := VerifyMessageSignature(message, sig, wallet); err != nil {
+		return SessionKeyDelegation{}, fmt.Errorf("%w: %v", ErrInvalidDelegation, err)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,144 @@
+package solauth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/portto/solana-go-sdk/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSessionKeyDelegation(t *testing.T) {
+	d := solauth.SessionKeyDelegation{
+		Domain:     "example.com",
+		Wallet:     wallet.PublicKey.ToBase58(),
+		SessionKey: types.NewAccount().PublicKey.ToBase58(),
+		Scopes:     []string{"game:play", "game:trade"},
+		IssuedAt:   time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+		ExpiresAt:  time.Date(2023, 5, 1, 20, 0, 0, 0, time.UTC),
+	}
+
+	parsed, err := solauth.ParseSessionKeyDelegation(d.String())
+	require.NoError(t, err)
+	require.Equal(t, d, parsed)
+
+	for name, message := range map[string]string{
+		"extra field":   d.String() + "\nNonce: 12345678",
+		"reordered":     strings.Replace(d.String(), "Scopes: game:play game:trade\nIssued At: 2023-05-01T12:00:00Z", "Issued At: 2023-05-01T12:00:00Z\nScopes: game:play game:trade", 1),
+		"session key":   strings.Replace(d.String(), d.SessionKey, d.Wallet, 1),
+		"no expiration": strings.TrimSuffix(d.String(), "\nExpiration Time: 2023-05-01T20:00:00Z"),
+	} {
+		_, err := solauth.ParseSessionKeyDelegation(message)
+		require.ErrorIs(t, err, solauth.ErrInvalidDelegation, name)
+	}
+}
+
+func TestVerifySessionKey(t *testing.T) {
+	walletAddr := wallet.PublicKey.ToBase58()
+	sessionKey := types.NewAccount()
+
+	resolver := solauth.RoleResolverFunc(func(ctx context.Context, walletAddr string) (solauth.Grant, error) {
+		return solauth.Grant{Scopes: []string{"game:play", "users:manage"}, Roles: []string{"admin"}}, nil
+	})
+	j := solauth.NewJWT(authSigningKey,
+		solauth.WithRoleResolver(resolver),
+		solauth.WithRefreshTokenStore(solauth.NewMemoryRefreshTokenStore()),
+	)
+	challenger := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0)
+	handler := solauth.VerifySessionKey(challenger, j, "example.com", solauth.WithMaxDelegationTTL(time.Hour*8))
+
+	now := time.Now().Truncate(time.Second)
+	delegation := solauth.SessionKeyDelegation{
+		Domain:     "example.com",
+		Wallet:     walletAddr,
+		SessionKey: sessionKey.PublicKey.ToBase58(),
+		Scopes:     []string{"game:play", "game:trade"},
+		IssuedAt:   now,
+		ExpiresAt:  now.Add(time.Minute * 30),
+	}
+
+	verify := func(d solauth.SessionKeyDelegation) *httptest.ResponseRecorder {
+		challenge, err := challenger.IssueChallenge(context.Background(), walletAddr)
+		require.NoError(t, err)
+
+		jsonData, err := json.Marshal(solauth.VerifySessionKeyPayload{
+			Delegation:          d.String(),
+			DelegationSignature: base64.StdEncoding.EncodeToString(wallet.Sign([]byte(d.String()))),
+			Message:             challenge.Message,
+			Signature:           base64.StdEncoding.EncodeToString(sessionKey.Sign([]byte(challenge.Message))),
+		})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/auth/verify/session", bytes.NewReader(jsonData)))
+		return rr
+	}
+
+	rr := verify(delegation)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var tokens solauth.TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&tokens))
+	require.LessOrEqual(t, tokens.ExpiresIn, int64(30*60))
+
+	claims, err := j.VerifyAccessToken(tokens.Access)
+	require.NoError(t, err)
+	require.Equal(t, walletAddr, claims.Wallet)
+	require.Equal(t, sessionKey.PublicKey.ToBase58(), claims.SessionKey)
+	require.Equal(t, []string{"game:play"}, claims.Scopes)
+	require.Empty(t, claims.Roles)
+
+	refreshClaims, err := j.VerifyRefreshToken(tokens.Refresh)
+	require.NoError(t, err)
+	require.False(t, refreshClaims.ExpiresAt.After(delegation.ExpiresAt))
+
+	// the session is kept on refresh
+	refreshed, err := j.RefreshToken(context.Background(), tokens.Refresh)
+	require.NoError(t, err)
+	claims, err = j.VerifyAccessToken(refreshed.Access)
+	require.NoError(t, err)
+	require.Equal(t, sessionKey.PublicKey.ToBase58(), claims.SessionKey)
+	require.Equal(t, []string{"game:play"}, claims.Scopes)
+
+	// the same delegation re-authenticates with the new challenge
+	require.Equal(t, http.StatusOK, verify(delegation).Code)
+
+	t.Run("invalid delegation", func(t *testing.T) {
+		d := delegation
+		d.Domain = "evil.com"
+		require.Equal(t, http.StatusBadRequest, verify(d).Code)
+
+		d = delegation
+		d.ExpiresAt = now.Add(time.Hour * 9)
+		require.Equal(t, http.StatusBadRequest, verify(d).Code)
+
+		d = delegation
+		d.IssuedAt, d.ExpiresAt = now.Add(-time.Hour*2), now.Add(-time.Hour)
+		require.Equal(t, http.StatusUnauthorized, verify(d).Code)
+	})
+
+	t.Run("signed by another key", func(t *testing.T) {
+		challenge, err := challenger.IssueChallenge(context.Background(), walletAddr)
+		require.NoError(t, err)
+
+		jsonData, err := json.Marshal(solauth.VerifySessionKeyPayload{
+			Delegation:          delegation.String(),
+			DelegationSignature: base64.StdEncoding.EncodeToString(wallet.Sign([]byte(delegation.String()))),
+			Message:             challenge.Message,
+			Signature:           base64.StdEncoding.EncodeToString(wallet.Sign([]byte(challenge.Message))),
+		})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/auth/verify/session", bytes.NewReader(jsonData)))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
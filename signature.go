@@ -2,35 +2,131 @@ package solauth
 
 import (
 	"crypto/ed25519"
-	"encoding/base64"
-	"fmt"
 
-	"github.com/mr-tron/base58"
 	"github.com/pkg/errors"
 )
 
+// SignatureScheme is the form in which the message was signed by the wallet.
+type SignatureScheme string
+
+// Supported signature schemes.
+const (
+	// SignatureSchemeRaw is the signature over the raw message bytes.
+	// This is how most of the browser wallets sign messages.
+	SignatureSchemeRaw SignatureScheme = "raw"
+	// SignatureSchemeOffchain is the signature over the message
+	// wrapped into the Solana off-chain message envelope.
+	// This is how Ledger devices sign messages.
+	SignatureSchemeOffchain SignatureScheme = "offchain"
+	// SignatureSchemeTransaction is the signature over the authentication
+	// transaction with the challenge in the memo, see VerifyAuthTransaction.
+	SignatureSchemeTransaction SignatureScheme = "transaction"
+)
+
 // VerifySignature verifies the signature of the request.
 // This function verifies the signature of the message using
 // the public key of the sender.
 // It returns error if the signature is NOT valid, otherwise nil.
+// The encodings of the signature and the public key are detected automatically,
+// see DecodeSignature and DecodePublicKey.
 func VerifySignature(message, signature, publicKey string) error {
-	publicKeyBytes, err := base58.Decode(publicKey)
+	publicKeyBytes, err := DecodePublicKey(publicKey, EncodingAuto)
+	if err != nil {
+		return err
+	}
+
+	sig, err := DecodeSignature(signature, EncodingAuto)
+	if err != nil {
+		return err
+	}
+
+	_, err = VerifyMessageSignature(message, sig, publicKeyBytes)
+	return err
+}
+
+// VerifyMessageSignature verifies the signature of the message using
+// the public key of the sender. The signature is accepted either over
+// the raw message or over the message wrapped into the off-chain message
+// envelope with the empty application domain and the sender as the only signer,
+// in any of the formats valid for the message.
+// Use VerifyOffchainEnvelope if the wallet sets the application domain or other signers.
+// It returns the scheme the message was signed with,
+// or error if the signature is NOT valid.
+func VerifyMessageSignature(message string, signature, publicKey []byte) (SignatureScheme, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return "", errors.Errorf("expected ed25519 public key size is: %v, got: %v", ed25519.PublicKeySize, len(publicKey))
+	}
+
+	if ed25519.Verify(ed25519.PublicKey(publicKey), []byte(message), signature) {
+		return SignatureSchemeRaw, nil
+	}
+
+	// Wallets are free to pick a less restrictive format than the detected one
+	for _, format := range []OffchainMessageFormat{
+		OffchainFormatRestrictedASCII,
+		OffchainFormatLimitedUTF8,
+		OffchainFormatExtendedUTF8,
+	} {
+		offchain := OffchainMessage{
+			Version: OffchainMessageVersion,
+			Format:  format,
+			Signers: [][]byte{publicKey},
+			Body:    []byte(message),
+		}
+		if offchain.Validate() != nil {
+			continue
+		}
+		if VerifyOffchainSignature(offchain, signature, publicKey) == nil {
+			return SignatureSchemeOffchain, nil
+		}
+	}
+
+	return "", errors.Errorf("signature is incorrect")
+}
+
+// VerifyOffchainEnvelope verifies the signature of the exact off-chain message
+// envelope signed by the wallet and checks that its body is the message.
+// The envelope can have any application domain, format and signers,
+// the public key must be one of the signers.
+func VerifyOffchainEnvelope(message string, envelope, signature, publicKey []byte) (SignatureScheme, error) {
+	offchain, err := DecodeOffchainMessage(envelope)
 	if err != nil {
-		return fmt.Errorf("failed to decode public key: %w", err)
+		return "", errors.Wrap(err, "invalid off-chain message")
+	}
+	if string(offchain.Body) != message {
+		return "", errors.Errorf("off-chain message body doesn't match the message")
 	}
+	if err := VerifyOffchainSignature(offchain, signature, publicKey); err != nil {
+		return "", err
+	}
+
+	return SignatureSchemeOffchain, nil
+}
 
-	if len(publicKeyBytes) != ed25519.PublicKeySize {
-		return errors.Errorf("expected ed25519 public key size is: %v, got: %v", ed25519.PublicKeySize, len(publicKeyBytes))
+// VerifyOffchainSignature verifies the signature of the off-chain message.
+// The public key must be one of the message signers.
+func VerifyOffchainSignature(m OffchainMessage, signature, publicKey []byte) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.Errorf("expected ed25519 public key size is: %v, got: %v", ed25519.PublicKeySize, len(publicKey))
+	}
+
+	isSigner := false
+	for _, s := range m.Signers {
+		if string(s) == string(publicKey) {
+			isSigner = true
+			break
+		}
+	}
+	if !isSigner {
+		return errors.Errorf("public key is not a signer of the off-chain message")
 	}
 
-	ed25519PublicKey := ed25519.PublicKey(publicKeyBytes)
-	sig, err := base64.StdEncoding.DecodeString(signature)
+	data, err := m.Encode()
 	if err != nil {
-		return errors.Wrap(err, "can't decode base64 signature")
+		return errors.Wrap(err, "can't encode off-chain message")
 	}
 
-	validSignature := ed25519.Verify(ed25519PublicKey, []byte(message), sig)
-	if !validSignature {
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), data, signature) {
 		return errors.Errorf("signature is incorrect")
 	}
 
@@ -0,0 +1,329 @@
+package solauth
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mr-tron/base58"
+)
+
+// Supported SIWS chain IDs.
+const (
+	SIWSChainMainnet = "mainnet"
+	SIWSChainDevnet  = "devnet"
+	SIWSChainTestnet = "testnet"
+)
+
+// SIWSVersion is the only supported version of the SIWS message.
+const SIWSVersion = "1"
+
+const siwsHeaderSuffix = " wants you to sign in with your Solana account:"
+
+// SIWSMessage is the Sign-In With Solana message.
+// The message text follows CAIP-122 as implemented by the Solana wallet standard,
+// so wallets like Phantom and Solflare can render it as a sign in request.
+type SIWSMessage struct {
+	// Domain is the RFC 3986 authority that is requesting the signing.
+	Domain string
+	// Address is the base58 encoded wallet address performing the signing.
+	Address string
+	// Statement is the optional human-readable assertion the wallet signs.
+	Statement string
+	// URI is the optional RFC 3986 URI referring to the resource of the signing.
+	URI string
+	// Version is the version of the message, must be "1".
+	Version string
+	// ChainID is the optional chain the session is bound to: mainnet, devnet or testnet.
+	ChainID string
+	// Nonce is the random string to prevent replay attacks.
+	Nonce string
+	// IssuedAt is the time the message was generated at.
+	IssuedAt time.Time
+	// ExpirationTime is the optional time the signed message is no longer valid after.
+	ExpirationTime time.Time
+	// NotBefore is the optional time the signed message becomes valid at.
+	NotBefore time.Time
+	// RequestID is the optional system-specific identifier of the request.
+	RequestID string
+	// Resources is the optional list of URIs the wallet wishes to have resolved.
+	Resources []string
+}
+
+// String returns the text of the message to sign.
+func (m SIWSMessage) String() string {
+	var sb strings.Builder
+	sb.WriteString(m.Domain + siwsHeaderSuffix + "\n")
+	sb.WriteString(m.Address)
+
+	if m.Statement != "" {
+		sb.WriteString("\n\n" + m.Statement)
+	}
+
+	fields := make([]string, 0, 10)
+	if m.URI != "" {
+		fields = append(fields, "URI: "+m.URI)
+	}
+	if m.Version != "" {
+		fields = append(fields, "Version: "+m.Version)
+	}
+	if m.ChainID != "" {
+		fields = append(fields, "Chain ID: "+m.ChainID)
+	}
+	if m.Nonce != "" {
+		fields = append(fields, "Nonce: "+m.Nonce)
+	}
+	if !m.IssuedAt.IsZero() {
+		fields = append(fields, "Issued At: "+formatSIWSTime(m.IssuedAt))
+	}
+	if !m.ExpirationTime.IsZero() {
+		fields = append(fields, "Expiration Time: "+formatSIWSTime(m.ExpirationTime))
+	}
+	if !m.NotBefore.IsZero() {
+		fields = append(fields, "Not Before: "+formatSIWSTime(m.NotBefore))
+	}
+	if m.RequestID != "" {
+		fields = append(fields, "Request ID: "+m.RequestID)
+	}
+	if len(m.Resources) > 0 {
+		fields = append(fields, "Resources:")
+		for _, r := range m.Resources {
+			fields = append(fields, "- "+r)
+		}
+	}
+
+	if len(fields) > 0 {
+		sb.WriteString("\n\n" + strings.Join(fields, "\n"))
+	}
+
+	return sb.String()
+}
+
+// Validate checks the message fields.
+func (m SIWSMessage) Validate() error {
+	if m.Domain == "" || strings.ContainsAny(m.Domain, " \n/") {
+		return fmt.Errorf("invalid domain: %q", m.Domain)
+	}
+	if b, err := base58.Decode(m.Address); err != nil || len(b) != 32 {
+		return fmt.Errorf("invalid address: %q", m.Address)
+	}
+	if strings.Contains(m.Statement, "\n") {
+		return fmt.Errorf("statement must not contain new lines")
+	}
+	if m.URI != "" {
+		if _, err := url.ParseRequestURI(m.URI); err != nil {
+			return fmt.Errorf("invalid uri: %w", err)
+		}
+	}
+	if m.Version != SIWSVersion {
+		return fmt.Errorf("unsupported version: %q", m.Version)
+	}
+	switch m.ChainID {
+	case "", SIWSChainMainnet, SIWSChainDevnet, SIWSChainTestnet:
+	default:
+		return fmt.Errorf("unsupported chain id: %q", m.ChainID)
+	}
+	if len(m.Nonce) < 8 || !isAlphanumeric(m.Nonce) {
+		return fmt.Errorf("nonce must be at least 8 alphanumeric characters")
+	}
+	if m.IssuedAt.IsZero() {
+		return fmt.Errorf("issued at is required")
+	}
+	if !m.ExpirationTime.IsZero() && !m.ExpirationTime.After(m.IssuedAt) {
+		return fmt.Errorf("expiration time must be after issued at")
+	}
+	for _, r := range m.Resources {
+		if _, err := url.ParseRequestURI(r); err != nil {
+			return fmt.Errorf("invalid resource: %w", err)
+		}
+	}
+	return nil
+}
+
+// ParseSIWSMessage parses the text of the SIWS message.
+// The parser is strict: fields must follow in the defined order,
+// unknown fields and malformed values are rejected.
+func ParseSIWSMessage(message string) (SIWSMessage, error) {
+	var m SIWSMessage
+
+	lines := strings.Split(message, "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], siwsHeaderSuffix) {
+		return SIWSMessage{}, fmt.Errorf("%w: missing SIWS header", ErrInvalidChallenge)
+	}
+	m.Domain = strings.TrimSuffix(lines[0], siwsHeaderSuffix)
+	m.Address = lines[1]
+	lines = lines[2:]
+
+	// Optional statement
+	if len(lines) >= 2 && lines[0] == "" && !isSIWSField(lines[1]) {
+		m.Statement = lines[1]
+		lines = lines[2:]
+	}
+
+	// Optional fields
+	if len(lines) > 0 {
+		if len(lines) < 2 || lines[0] != "" {
+			return SIWSMessage{}, fmt.Errorf("%w: malformed SIWS message", ErrInvalidChallenge)
+		}
+		lines = lines[1:]
+	}
+
+	next := 0
+	for i := 0; i < len(lines); i++ {
+		key, value, ok := strings.Cut(lines[i], ": ")
+		if !ok && lines[i] == "Resources:" {
+			key, ok = "Resources", true
+		}
+		if !ok {
+			return SIWSMessage{}, fmt.Errorf("%w: malformed SIWS field: %q", ErrInvalidChallenge, lines[i])
+		}
+
+		pos := indexOf(siwsFields, key)
+		if pos < next {
+			return SIWSMessage{}, fmt.Errorf("%w: unexpected SIWS field: %q", ErrInvalidChallenge, key)
+		}
+		next = pos + 1
+
+		var err error
+		switch key {
+		case "URI":
+			m.URI = value
+		case "Version":
+			m.Version = value
+		case "Chain ID":
+			m.ChainID = value
+		case "Nonce":
+			m.Nonce = value
+		case "Issued At":
+			m.IssuedAt, err = parseSIWSTime(value)
+		case "Expiration Time":
+			m.ExpirationTime, err = parseSIWSTime(value)
+		case "Not Before":
+			m.NotBefore, err = parseSIWSTime(value)
+		case "Request ID":
+			m.RequestID = value
+		case "Resources":
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], "- ") {
+				i++
+				m.Resources = append(m.Resources, strings.TrimPrefix(lines[i], "- "))
+			}
+			if len(m.Resources) == 0 {
+				err = fmt.Errorf("empty resources list")
+			}
+		}
+		if err != nil {
+			return SIWSMessage{}, fmt.Errorf("%w: invalid %s: %v", ErrInvalidChallenge, key, err)
+		}
+	}
+
+	if err := m.Validate(); err != nil {
+		return SIWSMessage{}, fmt.Errorf("%w: %v", ErrInvalidChallenge, err)
+	}
+
+	return m, nil
+}
+
+// SIWSFormat is the MessageFormat which issues challenges as SIWS messages.
+// On verification it checks that the domain, URI and chain ID in the signed text
+// match the configured ones.
+type SIWSFormat struct {
+	// Domain is the domain of the service, e.g. "example.com". Required.
+	Domain string
+	// URI is the URI of the service, e.g. "https://example.com/login".
+	URI string
+	// Statement is the text shown to the user in the wallet.
+	Statement string
+	// ChainID is the chain the session is bound to: mainnet, devnet or testnet.
+	ChainID string
+	// Resources is the list of URIs the wallet wishes to have resolved.
+	Resources []string
+}
+
+// Format builds the SIWS message for the challenge.
+func (f SIWSFormat) Format(c Challenge) string {
+	return SIWSMessage{
+		Domain:         f.Domain,
+		Address:        c.PublicKey,
+		Statement:      f.Statement,
+		URI:            f.URI,
+		Version:        SIWSVersion,
+		ChainID:        f.ChainID,
+		Nonce:          c.Nonce,
+		IssuedAt:       c.IssuedAt,
+		ExpirationTime: c.ExpiresAt,
+		NotBefore:      c.NotBefore,
+		RequestID:      c.RequestID,
+		Resources:      f.Resources,
+	}.String()
+}
+
+// Parse parses the SIWS message and checks it against the server expectations.
+func (f SIWSFormat) Parse(message string) (Challenge, error) {
+	m, err := ParseSIWSMessage(message)
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	if m.Domain != f.Domain {
+		return Challenge{}, fmt.Errorf("%w: unexpected domain: %q", ErrInvalidChallenge, m.Domain)
+	}
+	if m.URI != f.URI {
+		return Challenge{}, fmt.Errorf("%w: unexpected uri: %q", ErrInvalidChallenge, m.URI)
+	}
+	if m.ChainID != f.ChainID {
+		return Challenge{}, fmt.Errorf("%w: unexpected chain id: %q", ErrInvalidChallenge, m.ChainID)
+	}
+	if m.ExpirationTime.IsZero() {
+		return Challenge{}, fmt.Errorf("%w: expiration time is required", ErrInvalidChallenge)
+	}
+
+	return Challenge{
+		PublicKey: m.Address,
+		Nonce:     m.Nonce,
+		IssuedAt:  m.IssuedAt,
+		ExpiresAt: m.ExpirationTime,
+		NotBefore: m.NotBefore,
+		RequestID: m.RequestID,
+		Message:   message,
+	}, nil
+}
+
+var siwsFields = []string{
+	"URI", "Version", "Chain ID", "Nonce", "Issued At",
+	"Expiration Time", "Not Before", "Request ID", "Resources",
+}
+
+func isSIWSField(line string) bool {
+	if line == "Resources:" {
+		return true
+	}
+	key, _, ok := strings.Cut(line, ": ")
+	return ok && indexOf(siwsFields, key) >= 0
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func formatSIWSTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseSIWSTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,131 @@
+package solauth_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSIWSMessage(t *testing.T) {
+	issuedAt := time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)
+	msg := solauth.SIWSMessage{
+		Domain:         "example.com",
+		Address:        wallet.PublicKey.ToBase58(),
+		Statement:      "Sign in to Example",
+		URI:            "https://example.com/login",
+		Version:        solauth.SIWSVersion,
+		ChainID:        solauth.SIWSChainDevnet,
+		Nonce:          "a1b2c3d4e5",
+		IssuedAt:       issuedAt,
+		ExpirationTime: issuedAt.Add(time.Minute),
+		NotBefore:      issuedAt,
+		RequestID:      "req-1",
+		Resources:      []string{"https://example.com/terms", "ipfs://bafybeiemxf5abjwjbikoz4mc3a3dla6ual3jsgpdr4cjr3oz3evfyavhwq"},
+	}
+
+	text := msg.String()
+	require.Equal(t, strings.Join([]string{
+		"example.com wants you to sign in with your Solana account:",
+		wallet.PublicKey.ToBase58(),
+		"",
+		"Sign in to Example",
+		"",
+		"URI: https://example.com/login",
+		"Version: 1",
+		"Chain ID: devnet",
+		"Nonce: a1b2c3d4e5",
+		"Issued At: 2023-03-01T10:00:00Z",
+		"Expiration Time: 2023-03-01T10:01:00Z",
+		"Not Before: 2023-03-01T10:00:00Z",
+		"Request ID: req-1",
+		"Resources:",
+		"- https://example.com/terms",
+		"- ipfs://bafybeiemxf5abjwjbikoz4mc3a3dla6ual3jsgpdr4cjr3oz3evfyavhwq",
+	}, "\n"), text)
+
+	parsed, err := solauth.ParseSIWSMessage(text)
+	require.NoError(t, err)
+	require.Equal(t, msg.Domain, parsed.Domain)
+	require.Equal(t, msg.Statement, parsed.Statement)
+	require.Equal(t, msg.Resources, parsed.Resources)
+	require.True(t, msg.ExpirationTime.Equal(parsed.ExpirationTime))
+	require.Equal(t, text, parsed.String())
+
+	t.Run("without statement", func(t *testing.T) {
+		m := msg
+		m.Statement = ""
+
+		parsed, err := solauth.ParseSIWSMessage(m.String())
+		require.NoError(t, err)
+		require.Empty(t, parsed.Statement)
+		require.Equal(t, m.String(), parsed.String())
+	})
+
+	t.Run("strict parser", func(t *testing.T) {
+		for name, text := range map[string]string{
+			"fields order":  strings.Replace(text, "Version: 1\nChain ID: devnet", "Chain ID: devnet\nVersion: 1", 1),
+			"unknown field": strings.Replace(text, "Request ID: req-1", "Session: req-1", 1),
+			"chain id":      strings.Replace(text, "Chain ID: devnet", "Chain ID: localnet", 1),
+			"address":       strings.Replace(text, wallet.PublicKey.ToBase58(), "0xdeadbeef", 1),
+			"nonce":         strings.Replace(text, "Nonce: a1b2c3d4e5", "Nonce: 123", 1),
+			"issued at":     strings.Replace(text, "Issued At: 2023-03-01T10:00:00Z", "Issued At: yesterday", 1),
+			"header":        strings.Replace(text, "wants you to sign in", "asks you to sign in", 1),
+		} {
+			_, err := solauth.ParseSIWSMessage(text)
+			require.ErrorIs(t, err, solauth.ErrInvalidChallenge, name)
+		}
+	})
+}
+
+func TestSIWSFormat(t *testing.T) {
+	ctx := context.Background()
+	publicKey := wallet.PublicKey.ToBase58()
+	format := solauth.SIWSFormat{
+		Domain:    "example.com",
+		URI:       "https://example.com",
+		Statement: "Sign in to Example",
+		ChainID:   solauth.SIWSChainMainnet,
+	}
+
+	for name, c := range map[string]interface {
+		IssueChallenge(ctx context.Context, publicKey string) (solauth.Challenge, error)
+		VerifyChallenge(ctx context.Context, publicKey, message string) error
+	}{
+		"stored": solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), time.Minute, solauth.WithMessageFormat(format)),
+		"signed": solauth.NewSignedChallenger(authSigningKey, time.Minute, nil, solauth.WithMessageFormat(format)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			challenge, err := c.IssueChallenge(ctx, publicKey)
+			require.NoError(t, err)
+
+			msg, err := solauth.ParseSIWSMessage(challenge.Message)
+			require.NoError(t, err)
+			require.Equal(t, "example.com", msg.Domain)
+			require.Equal(t, publicKey, msg.Address)
+			require.Equal(t, challenge.Nonce, msg.Nonce)
+
+			// Another domain
+			phishing := strings.Replace(challenge.Message, "example.com wants", "examp1e.com wants", 1)
+			require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, phishing), solauth.ErrInvalidChallenge)
+
+			// Another chain
+			devnet := strings.Replace(challenge.Message, "Chain ID: mainnet", "Chain ID: devnet", 1)
+			require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, devnet), solauth.ErrInvalidChallenge)
+
+			// Another statement with the valid nonce
+			statement := strings.Replace(challenge.Message, "Sign in to Example", "Approve the transfer", 1)
+			require.NotEqual(t, challenge.Message, statement)
+			require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, statement), solauth.ErrChallengeMismatch)
+
+			// Extra resources with the valid nonce
+			resources := challenge.Message + "\nResources:\n- https://evil.com"
+			require.ErrorIs(t, c.VerifyChallenge(ctx, publicKey, resources), solauth.ErrChallengeMismatch)
+
+			require.NoError(t, c.VerifyChallenge(ctx, publicKey, challenge.Message))
+		})
+	}
+}
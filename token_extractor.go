@@ -0,0 +1,101 @@
+package solauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/auth/jwt"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// TokenExtractor extracts the token from the request.
+// It returns empty string if there is no token in the request.
+type TokenExtractor func(r *http.Request) string
+
+// BearerTokenExtractor extracts the token from the "Authorization: Bearer <token>" header.
+func BearerTokenExtractor() TokenExtractor {
+	return func(r *http.Request) string {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	}
+}
+
+// HeaderTokenExtractor extracts the token from the header with the given name as is.
+func HeaderTokenExtractor(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(name))
+	}
+}
+
+// CookieTokenExtractor extracts the token from the cookie with the given name.
+func CookieTokenExtractor(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// QueryTokenExtractor extracts the token from the query parameter with the given name,
+// e.g. for WebSocket upgrade requests which can't have custom headers.
+// Tokens in URLs end up in access logs, so use it for such requests only.
+func QueryTokenExtractor(param string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(param)
+	}
+}
+
+// ChainTokenExtractors returns the extractor which tries the given ones
+// in priority order and returns the first found token.
+func ChainTokenExtractors(extractors ...TokenExtractor) TokenExtractor {
+	return func(r *http.Request) string {
+		for _, e := range extractors {
+			if token := e(r); token != "" {
+				return token
+			}
+		}
+		return ""
+	}
+}
+
+// DefaultTokenExtractor extracts the token from the "Authorization" header
+// with or without the "Bearer" scheme.
+func DefaultTokenExtractor() TokenExtractor {
+	return ChainTokenExtractors(BearerTokenExtractor(), HeaderTokenExtractor("Authorization"))
+}
+
+// HTTPToContext is the go-kit server request function which puts the token
+// extracted from the request to the context for GoKitMiddleware.
+// If no extractor is given, DefaultTokenExtractor is used.
+func HTTPToContext(extractors ...TokenExtractor) kithttp.RequestFunc {
+	extract := DefaultTokenExtractor()
+	if len(extractors) > 0 {
+		extract = ChainTokenExtractors(extractors...)
+	}
+
+	return func(ctx context.Context, r *http.Request) context.Context {
+		token := extract(r)
+		if token == "" {
+			return ctx
+		}
+		return context.WithValue(ctx, jwt.JWTContextKey, token)
+	}
+}
+
+// ContextToHTTP is the go-kit client request function which sets
+// the "Authorization: Bearer <token>" header from the token in the context,
+// so the token is passed to the downstream services.
+func ContextToHTTP() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if token, ok := ctx.Value(jwt.JWTContextKey).(string); ok && token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return ctx
+	}
+}
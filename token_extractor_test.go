@@ -0,0 +1,98 @@
+package solauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenExtractors(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ws?access_token=from-query", nil)
+	req.Header.Set("Authorization", "Bearer from-bearer")
+	req.Header.Set("X-Access-Token", "from-header")
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: "from-cookie"})
+
+	require.Equal(t, "from-bearer", solauth.BearerTokenExtractor()(req))
+	require.Equal(t, "from-header", solauth.HeaderTokenExtractor("X-Access-Token")(req))
+	require.Equal(t, "from-cookie", solauth.CookieTokenExtractor("access_token")(req))
+	require.Equal(t, "from-query", solauth.QueryTokenExtractor("access_token")(req))
+	require.Empty(t, solauth.CookieTokenExtractor("session")(req))
+
+	chain := solauth.ChainTokenExtractors(
+		solauth.CookieTokenExtractor("session"),
+		solauth.QueryTokenExtractor("access_token"),
+		solauth.BearerTokenExtractor(),
+	)
+	require.Equal(t, "from-query", chain(req))
+
+	t.Run("bearer scheme", func(t *testing.T) {
+		for header, token := range map[string]string{
+			"Bearer token": "token",
+			"bearer token": "token",
+			"Basic token":  "",
+			"token":        "",
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", header)
+			require.Equal(t, token, solauth.BearerTokenExtractor()(req), header)
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		require.Equal(t, "token", solauth.DefaultTokenExtractor()(req))
+
+		req.Header.Set("Authorization", "token")
+		require.Equal(t, "token", solauth.DefaultTokenExtractor()(req))
+	})
+}
+
+func TestMiddlewareTokenExtractor(t *testing.T) {
+	j := solauth.NewJWT(authSigningKey)
+	tokens, err := j.IssueTokens(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.Access)
+	rr := httptest.NewRecorder()
+	solauth.Middleware(j)(ok).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: tokens.Access})
+	rr = httptest.NewRecorder()
+	solauth.Middleware(j, solauth.WithTokenExtractor(solauth.CookieTokenExtractor("access_token")))(ok).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	solauth.Middleware(j)(ok).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestGoKitRequestFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/?token=from-query", nil)
+	req.Header.Set("Authorization", "Bearer from-bearer")
+
+	ctx := solauth.HTTPToContext()(context.Background(), req)
+	require.Equal(t, "from-bearer", ctx.Value(kitjwt.JWTContextKey))
+
+	ctx = solauth.HTTPToContext(solauth.QueryTokenExtractor("token"))(context.Background(), req)
+	require.Equal(t, "from-query", ctx.Value(kitjwt.JWTContextKey))
+
+	ctx = solauth.HTTPToContext(solauth.CookieTokenExtractor("token"))(context.Background(), req)
+	require.Nil(t, ctx.Value(kitjwt.JWTContextKey))
+
+	out := httptest.NewRequest(http.MethodGet, "/", nil)
+	solauth.ContextToHTTP()(context.WithValue(context.Background(), kitjwt.JWTContextKey, "token"), out)
+	require.Equal(t, "Bearer token", out.Header.Get("Authorization"))
+}
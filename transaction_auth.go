@@ -0,0 +1,170 @@
+package solauth
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/portto/solana-go-sdk/common"
+)
+
+// DummyBlockhash is the recent blockhash the authentication transaction
+// must be built with. It's not a real blockhash, so the transaction
+// can never be executed on-chain even if it leaks.
+const DummyBlockhash = "11111111111111111111111111111111"
+
+// Memo program IDs allowed in the authentication transaction.
+var memoProgramIDs = map[common.PublicKey]bool{
+	common.MemoProgramID: true, // Memo v2
+	common.PublicKeyFromString("Memo1UhkJRfHyvLMcVucJwxXeuD728EqVDDwQDxFMNo"): true, // Memo v1
+}
+
+// VerifyAuthTransaction verifies the serialized authentication transaction.
+// It's used by hardware wallets and multisig setups which can sign transactions only.
+// The transaction must never be broadcast, so it must be built with DummyBlockhash,
+// have the wallet as the fee payer and the only signer, and contain Memo
+// instructions only, with the challenge message in the memo.
+// It returns the memo text if the transaction is valid and signed by the wallet.
+func VerifyAuthTransaction(rawTx []byte, publicKey string) (string, error) {
+	tx, err := deserializeTransaction(rawTx)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	if len(tx.signatures) != 1 {
+		return "", fmt.Errorf("authentication transaction must have exactly one signer")
+	}
+
+	if tx.lookupTables > 0 {
+		return "", fmt.Errorf("address lookup tables are not allowed in the authentication transaction")
+	}
+	if tx.numSigners != 1 || len(tx.accounts) == 0 {
+		return "", fmt.Errorf("authentication transaction must have exactly one signer")
+	}
+	if tx.accounts[0].ToBase58() != publicKey {
+		return "", fmt.Errorf("fee payer of the transaction doesn't match public_key")
+	}
+	if tx.blockhash != DummyBlockhash {
+		return "", fmt.Errorf("authentication transaction must use the dummy blockhash: %s", DummyBlockhash)
+	}
+
+	var memo string
+	for _, ix := range tx.instructions {
+		if ix.programIndex >= len(tx.accounts) || !memoProgramIDs[tx.accounts[ix.programIndex]] {
+			return "", fmt.Errorf("only memo instructions are allowed in the authentication transaction")
+		}
+		if memo != "" {
+			return "", fmt.Errorf("authentication transaction must contain exactly one memo")
+		}
+		if len(ix.data) == 0 || !utf8.Valid(ix.data) {
+			return "", fmt.Errorf("memo must be a non-empty UTF-8 text")
+		}
+		memo = string(ix.data)
+	}
+	if memo == "" {
+		return "", fmt.Errorf("authentication transaction must contain exactly one memo")
+	}
+
+	// The signature is verified over the message bytes as they were submitted
+	if !ed25519.Verify(tx.accounts[0].Bytes(), tx.message, tx.signatures[0]) {
+		return "", fmt.Errorf("transaction signature is incorrect")
+	}
+
+	return memo, nil
+}
+
+// authTransaction is the decoded transaction in the Solana wire format.
+type authTransaction struct {
+	signatures [][]byte
+	// message is the signed message bytes
+	message      []byte
+	numSigners   int
+	accounts     []common.PublicKey
+	blockhash    string
+	instructions []authInstruction
+	lookupTables int
+}
+
+// authInstruction is the compiled instruction of the transaction.
+type authInstruction struct {
+	programIndex int
+	data         []byte
+}
+
+// deserializeTransaction decodes the legacy or v0 transaction received from the client.
+// Every length is checked against the input, so the malformed transaction is an error.
+func deserializeTransaction(rawTx []byte) (authTransaction, error) {
+	var tx authTransaction
+	r := borshReader{data: rawTx}
+
+	count := r.shortVec()
+	for i := 0; i < count && !r.err; i++ {
+		tx.signatures = append(tx.signatures, r.bytes(ed25519.SignatureSize))
+	}
+	if r.err {
+		return authTransaction{}, fmt.Errorf("transaction is too short")
+	}
+	tx.message = r.data
+
+	versioned := false
+	if len(r.data) > 0 && r.data[0]&0x80 != 0 {
+		if version := r.u8() & 0x7f; version != 0 {
+			return authTransaction{}, fmt.Errorf("unsupported transaction version: %d", version)
+		}
+		versioned = true
+	}
+
+	// header: required signatures, read-only signed and unsigned accounts
+	tx.numSigners = int(r.u8())
+	r.skip(2)
+
+	count = r.shortVec()
+	for i := 0; i < count && !r.err; i++ {
+		tx.accounts = append(tx.accounts, common.PublicKeyFromBytes(r.bytes(common.PublicKeyLength)))
+	}
+	if blockhash := r.bytes(common.PublicKeyLength); blockhash != nil {
+		tx.blockhash = common.PublicKeyFromBytes(blockhash).ToBase58()
+	}
+
+	count = r.shortVec()
+	for i := 0; i < count && !r.err; i++ {
+		ix := authInstruction{programIndex: int(r.u8())}
+		r.skip(r.shortVec())
+		ix.data = r.bytes(r.shortVec())
+		tx.instructions = append(tx.instructions, ix)
+	}
+
+	if versioned {
+		tx.lookupTables = r.shortVec()
+		for i := 0; i < tx.lookupTables && !r.err; i++ {
+			r.skip(common.PublicKeyLength)
+			r.skip(r.shortVec())
+			r.skip(r.shortVec())
+		}
+	}
+
+	if r.err {
+		return authTransaction{}, fmt.Errorf("malformed transaction message")
+	}
+	if len(r.data) > 0 {
+		return authTransaction{}, fmt.Errorf("unexpected data after the transaction message")
+	}
+
+	return tx, nil
+}
+
+// decodeShortVecLen decodes the compact-u16 length prefix.
+// It returns the length and the size of the prefix in bytes.
+func decodeShortVecLen(data []byte) (int, int, error) {
+	var length int
+	for i := 0; i < 3; i++ {
+		if i >= len(data) {
+			return 0, 0, fmt.Errorf("unexpected end of data")
+		}
+		b := data[i]
+		length |= int(b&0x7f) << (i * 7)
+		if b&0x80 == 0 {
+			return length, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid compact-u16 length")
+}
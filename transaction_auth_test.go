@@ -0,0 +1,150 @@
+package solauth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/portto/solana-go-sdk/program/memo"
+	"github.com/portto/solana-go-sdk/program/system"
+	"github.com/portto/solana-go-sdk/types"
+	"github.com/stretchr/testify/require"
+)
+
+func buildAuthTransaction(t *testing.T, blockhash string, instructions ...types.Instruction) []byte {
+	tx, err := types.NewTransaction(types.NewTransactionParam{
+		Message: types.NewMessage(types.NewMessageParam{
+			FeePayer:        wallet.PublicKey,
+			RecentBlockhash: blockhash,
+			Instructions:    instructions,
+		}),
+		Signers: []types.Account{wallet},
+	})
+	require.NoError(t, err)
+
+	rawTx, err := tx.Serialize()
+	require.NoError(t, err)
+
+	return rawTx
+}
+
+func TestVerifyAuthTransaction(t *testing.T) {
+	publicKey := wallet.PublicKey.ToBase58()
+	memoIx := memo.BuildMemo(memo.BuildMemoParam{Memo: []byte("challenge message")})
+
+	t.Run("valid", func(t *testing.T) {
+		message, err := solauth.VerifyAuthTransaction(buildAuthTransaction(t, solauth.DummyBlockhash, memoIx), publicKey)
+		require.NoError(t, err)
+		require.Equal(t, "challenge message", message)
+	})
+
+	t.Run("another wallet", func(t *testing.T) {
+		_, err := solauth.VerifyAuthTransaction(buildAuthTransaction(t, solauth.DummyBlockhash, memoIx), "9B5XszUGdMaxCZ7uSQhPzdks5ZQSmWxrmzCSvtJ6Ns6g")
+		require.Error(t, err)
+	})
+
+	t.Run("real blockhash", func(t *testing.T) {
+		_, err := solauth.VerifyAuthTransaction(buildAuthTransaction(t, "EkSnNWid2cvwEVnVx9aBqawnmiCNiDgp3gUdkDPTKN1N", memoIx), publicKey)
+		require.Error(t, err)
+	})
+
+	t.Run("transfer instruction", func(t *testing.T) {
+		transferIx := system.Transfer(system.TransferParam{
+			From:   wallet.PublicKey,
+			To:     types.NewAccount().PublicKey,
+			Amount: 1,
+		})
+		_, err := solauth.VerifyAuthTransaction(buildAuthTransaction(t, solauth.DummyBlockhash, memoIx, transferIx), publicKey)
+		require.Error(t, err)
+	})
+
+	t.Run("versioned transaction", func(t *testing.T) {
+		legacy := buildAuthTransaction(t, solauth.DummyBlockhash, memoIx)
+		// v0 message without address lookup tables
+		message := append(append([]byte{0x80}, legacy[1+64:]...), 0)
+		rawTx := append(append([]byte{1}, wallet.Sign(message)...), message...)
+
+		memo, err := solauth.VerifyAuthTransaction(rawTx, publicKey)
+		require.NoError(t, err)
+		require.Equal(t, "challenge message", memo)
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		rawTx := buildAuthTransaction(t, solauth.DummyBlockhash, memoIx)
+		rawTx[1] ^= 0xff
+		_, err := solauth.VerifyAuthTransaction(rawTx, publicKey)
+		require.Error(t, err)
+	})
+}
+
+func TestVerifyAuthTransactionMalformed(t *testing.T) {
+	publicKey := wallet.PublicKey.ToBase58()
+	rawTx := buildAuthTransaction(t, solauth.DummyBlockhash, memo.BuildMemo(memo.BuildMemoParam{Memo: []byte("challenge message")}))
+
+	cases := map[string][]byte{
+		"empty":                  {},
+		"no message":             append([]byte{1}, make([]byte, 64)...),
+		"no signatures":          {0, 1, 0, 1},
+		"truncated signatures":   append([]byte{2}, make([]byte, 100)...),
+		"invalid length prefix":  {0xff, 0xff, 0xff, 0xff},
+		"truncated header":       rawTx[:1+64+2],
+		"truncated accounts":     rawTx[:1+64+3+1+16],
+		"truncated blockhash":    rawTx[:1+64+3+1+64+16],
+		"truncated instructions": rawTx[:len(rawTx)-5],
+		"garbage":                bytes.Repeat([]byte{0xff}, 200),
+		"trailing data":          append(append([]byte{}, rawTx...), 0),
+		"unsupported version":    append(append([]byte{}, rawTx[:1+64]...), append([]byte{0x81}, rawTx[1+64:]...)...),
+	}
+	for i := 0; i < len(rawTx); i++ {
+		cases[fmt.Sprintf("truncated to %d bytes", i)] = rawTx[:i]
+	}
+
+	for name, data := range cases {
+		require.NotPanics(t, func() {
+			_, err := solauth.VerifyAuthTransaction(data, publicKey)
+			require.Error(t, err)
+		}, name)
+	}
+}
+
+func TestVerifySignedTransaction(t *testing.T) {
+	challenger := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0)
+	handler := solauth.VerifySignedTransaction(challenger, solauth.NewJWT(authSigningKey))
+
+	challenge, err := challenger.IssueChallenge(context.Background(), wallet.PublicKey.ToBase58())
+	require.NoError(t, err)
+
+	rawTx := buildAuthTransaction(t, solauth.DummyBlockhash, memo.BuildMemo(memo.BuildMemoParam{
+		Memo: []byte(challenge.Message),
+	}))
+
+	reqData := solauth.VerifySignedTransactionPayload{
+		Transaction: base64.StdEncoding.EncodeToString(rawTx),
+		PublicKey:   wallet.PublicKey.ToBase58(),
+	}
+	jsonData, err := json.Marshal(reqData)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/verify/transaction", bytes.NewReader(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	res := rr.Result()
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	response := make(map[string]interface{})
+	err = json.NewDecoder(res.Body).Decode(&response)
+	require.NoError(t, err)
+	require.NotEmpty(t, response["access_token"])
+	require.NotEmpty(t, response["refresh_token"])
+}
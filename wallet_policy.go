@@ -0,0 +1,131 @@
+package solauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// WalletPolicy decides whether the wallet can sign in and refresh tokens.
+// Check returns error wrapping ErrWalletBanned or ErrWalletNotAllowed
+// if the wallet is denied, any other error is treated as the internal one.
+type WalletPolicy interface {
+	Check(ctx context.Context, walletAddr string) error
+}
+
+// WalletLists is the allowlist and the denylist of the wallets, e.g.:
+//
+//	{
+//		"allowed": ["8ZbN5Ug3Tt1a...", "3vQB7B6MrGQZ..."],
+//		"banned": ["7Np41oeYqPef..."]
+//	}
+//
+// Banned wallets are denied even if they are allowed.
+type WalletLists struct {
+	// Allowed is the allowlist, e.g. for the closed beta.
+	// If it's nil, every wallet which is not banned is allowed,
+	// if it's empty but not nil, no wallet is allowed.
+	Allowed []string `json:"allowed"`
+	// Banned is the denylist, e.g. of the sanctioned or abusive wallets.
+	Banned []string `json:"banned"`
+}
+
+// LoadWalletLists loads the wallet lists from the JSON file.
+func LoadWalletLists(path string) (WalletLists, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return WalletLists{}, fmt.Errorf("failed to load wallet lists: %w", err)
+	}
+
+	var l WalletLists
+	if err := json.Unmarshal(data, &l); err != nil {
+		return WalletLists{}, fmt.Errorf("failed to parse wallet lists: %w", err)
+	}
+
+	return l, nil
+}
+
+// walletSets is the lookup form of WalletLists.
+type walletSets struct {
+	allowed map[string]bool // nil if the allowlist is disabled
+	banned  map[string]bool
+}
+
+// MemoryWalletPolicy is the in-memory WalletPolicy.
+// The lists can be replaced at any time with SetLists.
+// The zero value has no lists and allows all wallets.
+type MemoryWalletPolicy struct {
+	sets atomic.Pointer[walletSets]
+}
+
+// NewMemoryWalletPolicy creates a new policy with the given lists.
+func NewMemoryWalletPolicy(lists WalletLists) *MemoryWalletPolicy {
+	p := &MemoryWalletPolicy{}
+	p.SetLists(lists)
+	return p
+}
+
+// SetLists replaces the lists of the policy.
+// It's safe to call concurrently with the checks.
+func (p *MemoryWalletPolicy) SetLists(lists WalletLists) {
+	sets := &walletSets{banned: make(map[string]bool, len(lists.Banned))}
+	for _, addr := range lists.Banned {
+		sets.banned[addr] = true
+	}
+	if lists.Allowed != nil {
+		sets.allowed = make(map[string]bool, len(lists.Allowed))
+		for _, addr := range lists.Allowed {
+			sets.allowed[addr] = true
+		}
+	}
+	p.sets.Store(sets)
+}
+
+// Check returns ErrWalletBanned if the wallet is banned,
+// and ErrWalletNotAllowed if the allowlist is set and the wallet is not in it.
+func (p *MemoryWalletPolicy) Check(_ context.Context, walletAddr string) error {
+	sets := p.sets.Load()
+	if sets == nil {
+		return nil
+	}
+	if sets.banned[walletAddr] {
+		return ErrWalletBanned
+	}
+	if sets.allowed != nil && !sets.allowed[walletAddr] {
+		return ErrWalletNotAllowed
+	}
+	return nil
+}
+
+// FileWalletPolicy is the WalletPolicy with the lists loaded from the JSON file,
+// see WalletLists for the format. Call Reload to apply the changes of the file,
+// e.g. on SIGHUP.
+type FileWalletPolicy struct {
+	*MemoryWalletPolicy
+	path string
+}
+
+// NewFileWalletPolicy loads the lists from the file and creates a new policy.
+func NewFileWalletPolicy(path string) (*FileWalletPolicy, error) {
+	lists, err := LoadWalletLists(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWalletPolicy{
+		MemoryWalletPolicy: NewMemoryWalletPolicy(lists),
+		path:               path,
+	}, nil
+}
+
+// Reload loads the lists from the file again.
+// The current lists are kept if the file can't be loaded.
+func (p *FileWalletPolicy) Reload() error {
+	lists, err := LoadWalletLists(p.path)
+	if err != nil {
+		return err
+	}
+	p.SetLists(lists)
+	return nil
+}
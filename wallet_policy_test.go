@@ -0,0 +1,121 @@
+package solauth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dmitrymomot/solauth"
+	"github.com/portto/solana-go-sdk/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWalletPolicy(t *testing.T) {
+	ctx := context.Background()
+	alice := types.NewAccount().PublicKey.ToBase58()
+	bob := types.NewAccount().PublicKey.ToBase58()
+
+	path := filepath.Join(t.TempDir(), "wallets.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"banned": ["`+bob+`"]}`), 0o600))
+
+	policy, err := solauth.NewFileWalletPolicy(path)
+	require.NoError(t, err)
+	require.NoError(t, policy.Check(ctx, alice))
+	require.ErrorIs(t, policy.Check(ctx, bob), solauth.ErrWalletBanned)
+
+	// closed beta: bob is allowed but still banned
+	require.NoError(t, os.WriteFile(path, []byte(`{"allowed": ["`+alice+`", "`+bob+`"], "banned": ["`+bob+`"]}`), 0o600))
+	require.NoError(t, policy.Reload())
+	require.NoError(t, policy.Check(ctx, alice))
+	require.ErrorIs(t, policy.Check(ctx, bob), solauth.ErrWalletBanned)
+	require.ErrorIs(t, policy.Check(ctx, wallet.PublicKey.ToBase58()), solauth.ErrWalletNotAllowed)
+
+	// the current lists are kept if the file is broken
+	require.NoError(t, os.WriteFile(path, []byte(`{"allowed": [`), 0o600))
+	require.Error(t, policy.Reload())
+	require.NoError(t, policy.Check(ctx, alice))
+
+	// empty allowlist allows nobody
+	policy.SetLists(solauth.WalletLists{Allowed: []string{}})
+	require.ErrorIs(t, policy.Check(ctx, alice), solauth.ErrWalletNotAllowed)
+
+	// zero value allows all
+	var zero solauth.MemoryWalletPolicy
+	require.NoError(t, zero.Check(ctx, alice))
+	zero.SetLists(solauth.WalletLists{Banned: []string{alice}})
+	require.ErrorIs(t, zero.Check(ctx, alice), solauth.ErrWalletBanned)
+}
+
+func TestHandlersWithWalletPolicy(t *testing.T) {
+	walletAddr := wallet.PublicKey.ToBase58()
+
+	policy := solauth.NewMemoryWalletPolicy(solauth.WalletLists{Allowed: []string{}})
+	opt := solauth.WithWalletPolicy(policy)
+
+	j := solauth.NewJWT(authSigningKey)
+	challenger := solauth.NewStoredChallenger(solauth.NewMemoryChallengeStore(), 0)
+
+	errorCode := func(rr *httptest.ResponseRecorder) string {
+		var res map[string]interface{}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&res))
+		code, _ := res["error_code"].(string)
+		return code
+	}
+
+	requestAuth := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		body := `{"public_key":"` + walletAddr + `"}`
+		solauth.RequestAuth(challenger, opt)(rr, httptest.NewRequest(http.MethodPost, "/auth/request", bytes.NewReader([]byte(body))))
+		return rr
+	}
+
+	signIn := func() *httptest.ResponseRecorder {
+		challenge, err := challenger.IssueChallenge(context.Background(), walletAddr)
+		require.NoError(t, err)
+
+		jsonData, err := json.Marshal(solauth.VerifySignedMessagePayload{
+			Message:   challenge.Message,
+			Signature: base64.StdEncoding.EncodeToString(wallet.Sign([]byte(challenge.Message))),
+			PublicKey: walletAddr,
+		})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		solauth.VerifySignedMessage(challenger, j, opt)(rr, httptest.NewRequest(http.MethodPost, "/auth/verify", bytes.NewReader(jsonData)))
+		return rr
+	}
+
+	rr := requestAuth()
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Equal(t, "wallet_not_allowed", errorCode(rr))
+
+	rr = signIn()
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Equal(t, "wallet_not_allowed", errorCode(rr))
+
+	policy.SetLists(solauth.WalletLists{Allowed: []string{walletAddr}})
+	require.Equal(t, http.StatusOK, requestAuth().Code)
+	rr = signIn()
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var tokens solauth.TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&tokens))
+
+	// banned wallet can't refresh tokens
+	policy.SetLists(solauth.WalletLists{Banned: []string{walletAddr}})
+	rr = httptest.NewRecorder()
+	body := `{"refresh_token":"` + tokens.Refresh + `"}`
+	solauth.RefreshToken(j, opt)(rr, httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewReader([]byte(body))))
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Equal(t, "wallet_banned", errorCode(rr))
+
+	rr = requestAuth()
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Equal(t, "wallet_banned", errorCode(rr))
+}